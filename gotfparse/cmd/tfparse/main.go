@@ -2,58 +2,267 @@
 // SPDX-License-Identifier: Apache-2.0
 package main
 
+// #include <stdlib.h>
+//
 // typedef struct {
 // char *json;
 // char *err;
+// char *diagnostics;
+// char *variable_files;
 // } parseResponse;
+//
+// typedef int (*blockCallback)(char *json, void *userdata);
+//
+// static inline int callBlockCallback(blockCallback callback, char *json, void *userdata) {
+//     return callback(json, userdata);
+// }
 import "C"
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/cloud-custodian/tfparse/gotfparse/pkg/converter"
 )
 
 //export Parse
-func Parse(a *C.char, stopHCL C.int, debug C.int, allowDownloads C.int, workspaceName *C.char, num_vars_files C.int, vars_files **C.char) (resp C.parseResponse) {
+func Parse(a *C.char, optionsJSON *C.char) (resp C.parseResponse) {
 	input := C.GoString(a)
 
+	opts, err := parseOptionsJSON(optionsJSON)
+	if err != nil {
+		return C.parseResponse{nil, C.CString(err.Error()), nil, nil}
+	}
+
+	ctx, cancel := opts.newContext()
+	defer cancel()
+
+	tfd, err := converter.NewTerraformConverterWithContext(ctx, input, opts.converterOptions()...)
+	if err != nil {
+		return C.parseResponse{nil, C.CString(fmt.Sprintf("unable to create TerraformConverter: %s", err)), nil, nil}
+	}
+	out, err := tfd.VisitJSONContext(ctx)
+	if err != nil {
+		return C.parseResponse{nil, C.CString(fmt.Sprintf("unable to visit TerraformConverter blocks: %s", err)), nil, nil}
+	}
+	j, err := out.MarshalJSON()
+	if err != nil {
+		return C.parseResponse{nil, C.CString(fmt.Sprintf("cannot generate JSON from path: %s", err)), nil, nil}
+	}
+
+	diags, variableFiles, err := marshalParseMetadata(tfd.Diagnostics(), tfd.VariableFiles())
+	if err != nil {
+		return C.parseResponse{nil, C.CString(err.Error()), nil, nil}
+	}
+
+	resp = C.parseResponse{C.CString(string(j)), nil, diags, variableFiles}
+	return resp
+}
+
+// ParseStream is like Parse, but rather than returning all of the blocks at
+// once, it calls callback with each block as a line of JSON as soon as it
+// has been visited. The JSON is freed once the callback returns, so the
+// callback must copy anything it needs to keep. If the callback returns a
+// non-zero value, parsing stops early without an error.
+//
+// The json of the response is always nil, the rest is as returned by Parse.
+//
+//export ParseStream
+func ParseStream(a *C.char, optionsJSON *C.char, callback C.blockCallback, userdata unsafe.Pointer) C.parseResponse {
+	input := C.GoString(a)
+
+	opts, err := parseOptionsJSON(optionsJSON)
+	if err != nil {
+		return C.parseResponse{nil, C.CString(err.Error()), nil, nil}
+	}
+
+	ctx, cancel := opts.newContext()
+	defer cancel()
+
+	tfd, err := converter.NewTerraformConverterWithContext(ctx, input, opts.converterOptions()...)
+	if err != nil {
+		return C.parseResponse{nil, C.CString(fmt.Sprintf("unable to create TerraformConverter: %s", err)), nil, nil}
+	}
+
+	w := &callbackWriter{callback: callback, userdata: userdata}
+	err = tfd.VisitNDJSON(ctx, w)
+	if err != nil && !errors.Is(err, errStoppedByCallback) {
+		return C.parseResponse{nil, C.CString(fmt.Sprintf("unable to visit TerraformConverter blocks: %s", err)), nil, nil}
+	}
+
+	diags, variableFiles, err := marshalParseMetadata(tfd.Diagnostics(), tfd.VariableFiles())
+	if err != nil {
+		return C.parseResponse{nil, C.CString(err.Error()), nil, nil}
+	}
+	return C.parseResponse{nil, nil, diags, variableFiles}
+}
+
+// marshalParseMetadata returns the diagnostics and the variable files of a
+// parse as JSON, to be freed by the caller.
+func marshalParseMetadata(diagnostics []converter.Diagnostic, variableFiles []string) (*C.char, *C.char, error) {
+	diags, err := json.Marshal(diagnostics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate JSON from diagnostics: %w", err)
+	}
+
+	files, err := json.Marshal(variableFiles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate JSON from variable files: %w", err)
+	}
+
+	return C.CString(string(diags)), C.CString(string(files)), nil
+}
+
+var errStoppedByCallback = errors.New("stopped by callback")
+
+// callbackWriter is an io.Writer that calls a C callback with each complete
+// line written to it.
+type callbackWriter struct {
+	callback C.blockCallback
+	userdata unsafe.Pointer
+	buf      bytes.Buffer
+}
+
+func (w *callbackWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buf.Write(line)
+			return len(p), nil
+		}
+
+		cLine := C.CString(string(bytes.TrimSuffix(line, []byte("\n"))))
+		stop := C.callBlockCallback(w.callback, cLine, w.userdata)
+		C.free(unsafe.Pointer(cLine))
+		if stop != 0 {
+			return len(p), errStoppedByCallback
+		}
+	}
+}
+
+// parseOptions are the options of Parse and ParseStream, which are passed
+// as a JSON object.
+type parseOptions struct {
+	StopOnHCLError      bool              `json:"stop_on_hcl_error"`
+	Debug               bool              `json:"debug"`
+	AllowDownloads      bool              `json:"allow_downloads"`
+	WorkspaceName       string            `json:"workspace_name"`
+	VarsPaths           []string          `json:"vars_paths"`
+	Variables           map[string]string `json:"variables"`
+	EnvVariables        map[string]string `json:"env_variables"` // nil means the process environment
+	AutoLoadTFVars      bool              `json:"auto_load_tfvars"`
+	AttributeReferences bool              `json:"attribute_references"`
+	TypedUnknowns       bool              `json:"typed_unknowns"`
+	ConditionalBranches bool              `json:"conditional_branches"`
+	PolicyDocuments     bool              `json:"policy_documents"`
+	FileDataSources     bool              `json:"file_data_sources"`
+	RemoteStateFiles    map[string]string `json:"remote_state_files"`
+	RemoteStateDir      string            `json:"remote_state_dir"`
+	DataSourceStubs     string            `json:"data_source_stubs"`
+	StateFile           string            `json:"state_file"`
+	PlanFile            string            `json:"plan_file"`
+	TimeoutMillis       int32             `json:"timeout_ms"`
+}
+
+func parseOptionsJSON(optionsJSON *C.char) (*parseOptions, error) {
+	opts := &parseOptions{WorkspaceName: "default", AutoLoadTFVars: true}
+	dec := json.NewDecoder(strings.NewReader(C.GoString(optionsJSON)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opts); err != nil {
+		return nil, fmt.Errorf("invalid parse options: %w", err)
+	}
+	return opts, nil
+}
+
+// newContext returns a context that times out after the timeout of the
+// options, or never if it isn't positive.
+func (o *parseOptions) newContext() (context.Context, context.CancelFunc) {
+	if o.TimeoutMillis > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(o.TimeoutMillis)*time.Millisecond)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (o *parseOptions) converterOptions() []converter.TerraformConverterOption {
 	options := []converter.TerraformConverterOption{}
-	if stopHCL != 0 {
+	if o.StopOnHCLError {
 		options = append(options, converter.WithStopOnHCLError())
 	}
 
-	if debug != 0 {
+	if o.Debug {
 		options = append(options, converter.WithDebug())
 	}
 
-	if allowDownloads != 0 {
-		options = append(options, converter.WithAllowDownloads(true))
-	} else {
-		options = append(options, converter.WithAllowDownloads(false))
+	options = append(options, converter.WithAllowDownloads(o.AllowDownloads))
+
+	options = append(options, converter.WithWorkspaceName(o.WorkspaceName))
+
+	if len(o.VarsPaths) != 0 {
+		options = append(options, converter.WithTFVarsPaths(o.VarsPaths...))
+	}
+
+	if len(o.Variables) != 0 {
+		options = append(options, converter.WithVariables(o.Variables))
 	}
 
-	options = append(options, converter.WithWorkspaceName(C.GoString(workspaceName)))
+	if o.EnvVariables != nil {
+		environ := []string{}
+		for key, value := range o.EnvVariables {
+			environ = append(environ, key+"="+value)
+		}
+		sort.Strings(environ)
+		options = append(options, converter.WithEnvVariables(environ))
+	}
 
-	var varFiles []string
-	for _, v := range unsafe.Slice(vars_files, num_vars_files) {
-		varFiles = append(varFiles, C.GoString(v))
+	options = append(options, converter.WithAutoLoadTFVars(o.AutoLoadTFVars))
+
+	if o.AttributeReferences {
+		options = append(options, converter.WithAttributeReferences())
+	}
+	if o.TypedUnknowns {
+		options = append(options, converter.WithTypedUnknowns())
 	}
-	if len(varFiles) != 0 {
-		options = append(options, converter.WithTFVarsPaths(varFiles...))
+	if o.ConditionalBranches {
+		options = append(options, converter.WithConditionalBranches())
 	}
 
-	tfd, err := converter.NewTerraformConverter(input, options...)
-	if err != nil {
-		return C.parseResponse{nil, C.CString(fmt.Sprintf("unable to create TerraformConverter: %s", err))}
+	if o.PolicyDocuments {
+		options = append(options, converter.WithPolicyDocuments())
 	}
-	j, err := tfd.VisitJSON().MarshalJSON()
-	if err != nil {
-		return C.parseResponse{nil, C.CString(fmt.Sprintf("cannot generate JSON from path: %s", err))}
+
+	if o.FileDataSources {
+		options = append(options, converter.WithFileDataSources())
 	}
 
-	resp = C.parseResponse{C.CString(string(j)), nil}
-	return resp
+	if len(o.RemoteStateFiles) != 0 {
+		options = append(options, converter.WithRemoteStateFiles(o.RemoteStateFiles))
+	}
+
+	if o.RemoteStateDir != "" {
+		options = append(options, converter.WithRemoteStateDir(o.RemoteStateDir))
+	}
+
+	if o.DataSourceStubs != "" {
+		options = append(options, converter.WithDataSourceStubs(o.DataSourceStubs))
+	}
+
+	if o.StateFile != "" {
+		options = append(options, converter.WithStateFile(o.StateFile))
+	}
+
+	if o.PlanFile != "" {
+		options = append(options, converter.WithPlanFile(o.PlanFile))
+	}
+
+	return options
 }
 
 func main() {}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,16 +17,63 @@ import (
 func main() {
 	if len(os.Args) < 2 {
 		executable := filepath.Base(os.Args[0])
-		log.Fatalf("usage: %s PATH [--debug]", executable)
+		log.Fatalf("usage: %s PATH [--debug] [--diagnostics] [--variable-files] [--ndjson] [--var=NAME=VALUE] [--no-auto-tfvars] [--attribute-references] [--typed-unknowns] [--conditional-branches] [--policy-documents] [--file-data-sources] [--remote-state=KEY=PATH] [--remote-state-dir=PATH] [--stubs=PATH] [--state=PATH] [--plan=PATH]", executable)
 	}
 
 	// Check arguments for debug flag
 	var path string
 	debug := false
+	diagnostics := false
+	variableFiles := false
+	ndjson := false
+	variables := map[string]string{}
+	autoLoadTFVars := true
+	attributeReferences := false
+	typedUnknowns := false
+	conditionalBranches := false
+	policyDocuments := false
+	fileDataSources := false
+	remoteStateFiles := map[string]string{}
+	remoteStateDir := ""
+	stubsFile := ""
+	stateFile := ""
+	planFile := ""
 
 	for _, arg := range os.Args[1:] {
 		if arg == "--debug" {
 			debug = true
+		} else if arg == "--diagnostics" {
+			diagnostics = true
+		} else if arg == "--variable-files" {
+			variableFiles = true
+		} else if arg == "--ndjson" {
+			ndjson = true
+		} else if strings.HasPrefix(arg, "--var=") {
+			name, value, _ := strings.Cut(strings.TrimPrefix(arg, "--var="), "=")
+			variables[name] = value
+		} else if arg == "--no-auto-tfvars" {
+			autoLoadTFVars = false
+		} else if arg == "--attribute-references" {
+			attributeReferences = true
+		} else if arg == "--typed-unknowns" {
+			typedUnknowns = true
+		} else if arg == "--conditional-branches" {
+			conditionalBranches = true
+		} else if arg == "--policy-documents" {
+			policyDocuments = true
+		} else if arg == "--file-data-sources" {
+			fileDataSources = true
+		} else if strings.HasPrefix(arg, "--remote-state=") {
+			key, path, _ := strings.Cut(strings.TrimPrefix(arg, "--remote-state="), "=")
+			remoteStateFiles[key] = path
+		} else if strings.HasPrefix(arg, "--remote-state-dir=") {
+			remoteStateDir = strings.TrimPrefix(arg, "--remote-state-dir=")
+		} else if strings.HasPrefix(arg, "--stubs=") {
+			stubsFile = strings.TrimPrefix(arg, "--stubs=")
+		} else if strings.HasPrefix(arg, "--state=") {
+			stateFile = strings.TrimPrefix(arg, "--state=")
+		} else if strings.HasPrefix(arg, "--plan=") {
+			planFile = strings.TrimPrefix(arg, "--plan=")
 		} else if !strings.HasPrefix(arg, "--") {
 			path = arg
 		}
@@ -33,7 +81,7 @@ func main() {
 
 	if path == "" {
 		executable := filepath.Base(os.Args[0])
-		log.Fatalf("usage: %s PATH [--debug]", executable)
+		log.Fatalf("usage: %s PATH [--debug] [--diagnostics] [--variable-files] [--ndjson] [--var=NAME=VALUE] [--no-auto-tfvars] [--attribute-references] [--typed-unknowns] [--conditional-branches] [--policy-documents] [--file-data-sources] [--remote-state=KEY=PATH] [--remote-state-dir=PATH] [--stubs=PATH] [--state=PATH] [--plan=PATH]", executable)
 	}
 
 	// Create converter with options
@@ -41,11 +89,72 @@ func main() {
 	if debug {
 		opts = append(opts, converter.WithDebug())
 	}
+	if len(variables) > 0 {
+		// TF_VAR_ variables are read from the environment of the process
+		opts = append(opts, converter.WithVariables(variables))
+	}
+	if !autoLoadTFVars {
+		opts = append(opts, converter.WithAutoLoadTFVars(false))
+	}
+	if attributeReferences {
+		opts = append(opts, converter.WithAttributeReferences())
+	}
+	if typedUnknowns {
+		opts = append(opts, converter.WithTypedUnknowns())
+	}
+	if conditionalBranches {
+		opts = append(opts, converter.WithConditionalBranches())
+	}
+	if policyDocuments {
+		opts = append(opts, converter.WithPolicyDocuments())
+	}
+	if fileDataSources {
+		opts = append(opts, converter.WithFileDataSources())
+	}
+	if len(remoteStateFiles) > 0 {
+		opts = append(opts, converter.WithRemoteStateFiles(remoteStateFiles))
+	}
+	if remoteStateDir != "" {
+		opts = append(opts, converter.WithRemoteStateDir(remoteStateDir))
+	}
+	if stubsFile != "" {
+		opts = append(opts, converter.WithDataSourceStubs(stubsFile))
+	}
+	if stateFile != "" {
+		opts = append(opts, converter.WithStateFile(stateFile))
+	}
+	if planFile != "" {
+		opts = append(opts, converter.WithPlanFile(planFile))
+	}
 
 	tfd, err := converter.NewTerraformConverter(path, opts...)
 	checkError(err)
 
-	data := tfd.VisitJSON().Data()
+	if ndjson {
+		// one block per line, written as soon as each block is visited,
+		// followed by a line for each of the other keys that were asked for
+		checkError(tfd.VisitNDJSON(context.Background(), os.Stdout))
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		if diagnostics {
+			checkError(enc.Encode(map[string]any{"__diagnostics__": tfd.Diagnostics()}))
+		}
+		if variableFiles {
+			checkError(enc.Encode(map[string]any{"__variable_files__": tfd.VariableFiles()}))
+		}
+		return
+	}
+
+	out := tfd.VisitJSON()
+	if diagnostics {
+		_, err = out.Set(tfd.Diagnostics(), "__diagnostics__")
+		checkError(err)
+	}
+	if variableFiles {
+		_, err = out.Set(tfd.VariableFiles(), "__variable_files__")
+		checkError(err)
+	}
+	data := out.Data()
 
 	j, err := json.MarshalIndent(data, "", "\t")
 	checkError(err)
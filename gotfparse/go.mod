@@ -7,8 +7,10 @@ toolchain go1.24.6
 require (
 	github.com/Jeffail/gabs/v2 v2.7.0
 	github.com/aquasecurity/trivy v0.65.0
+	github.com/google/go-cmp v0.7.0
 	github.com/hashicorp/hcl/v2 v2.24.0
 	github.com/zclconf/go-cty v1.16.3
+	github.com/zclconf/go-cty-yaml v1.1.0
 )
 
 require (
@@ -68,7 +70,6 @@ require (
 	github.com/samber/lo v1.51.0 // indirect
 	github.com/spiffe/go-spiffe/v2 v2.5.0 // indirect
 	github.com/ulikunitz/xz v0.5.12 // indirect
-	github.com/zclconf/go-cty-yaml v1.1.0 // indirect
 	github.com/zeebo/errs v1.4.0 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
 	go.opentelemetry.io/contrib/detectors/gcp v1.37.0 // indirect
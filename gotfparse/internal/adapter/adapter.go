@@ -0,0 +1,126 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package adapter exposes details of trivy's terraform types that the
+// converter depends on, but which aren't all part of trivy's public API.
+//
+// Keeping every such access behind one interface means an upgrade of the
+// trivy fork that renames or removes a field fails with a descriptive error
+// from Check, rather than with a panic somewhere in the middle of a parse.
+package adapter
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+)
+
+// Terraform reads facts about parsed terraform blocks, attributes and
+// references.
+type Terraform interface {
+	// Check returns an error if this adapter can't read the trivy types it
+	// depends on, such as when a field it relies upon has been removed.
+	Check() error
+
+	// ReferenceParent returns the full name of the module block that a
+	// reference was made from, or "" for references in the root module.
+	ReferenceParent(r *terraform.Reference) (string, error)
+
+	// ModuleBlock returns the module block that a block was loaded through,
+	// or nil for blocks in the root module.
+	ModuleBlock(b *terraform.Block) (*terraform.Block, error)
+
+	// HCLAttribute returns the HCL attribute that an attribute was parsed from.
+	HCLAttribute(a *terraform.Attribute) (*hcl.Attribute, error)
+}
+
+// privateField describes an unexported struct field that Reflect reads.
+type privateField struct {
+	owner reflect.Type
+	name  string
+	typ   reflect.Type
+}
+
+var referenceParent = privateField{
+	owner: reflect.TypeFor[terraform.Reference](),
+	name:  "parent",
+	typ:   reflect.TypeFor[string](),
+}
+
+// Reflect is a Terraform adapter that uses the public API of trivy where it
+// is available, and reads unexported fields with reflection where it isn't.
+type Reflect struct{}
+
+var _ Terraform = Reflect{}
+
+// Check verifies that every unexported field read by Reflect exists and has
+// the expected type.
+func (Reflect) Check() error {
+	for _, f := range []privateField{referenceParent} {
+		if err := f.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (Reflect) ReferenceParent(r *terraform.Reference) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("cannot read the parent of a nil reference")
+	}
+	v, err := referenceParent.get(r)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (Reflect) ModuleBlock(b *terraform.Block) (*terraform.Block, error) {
+	if b == nil {
+		return nil, fmt.Errorf("cannot read the module block of a nil block")
+	}
+	return b.ModuleBlock(), nil
+}
+
+func (Reflect) HCLAttribute(a *terraform.Attribute) (*hcl.Attribute, error) {
+	if a == nil {
+		return nil, fmt.Errorf("cannot read the hcl attribute of a nil attribute")
+	}
+	hclAttr := a.HCLAttribute()
+	if hclAttr == nil {
+		return nil, fmt.Errorf("attribute %q has no hcl attribute", a.Name())
+	}
+	return hclAttr, nil
+}
+
+func (f privateField) check() error {
+	field, ok := f.owner.FieldByName(f.name)
+	if !ok {
+		return fmt.Errorf("%s has no field %q, the adapter needs updating for this version of trivy", f.owner, f.name)
+	}
+	if field.Type != f.typ {
+		return fmt.Errorf("%s.%s has type %s, expected %s, the adapter needs updating for this version of trivy",
+			f.owner, f.name, field.Type, f.typ)
+	}
+	return nil
+}
+
+// get returns the value of the field in obj, which must be a pointer to the
+// owning struct. Call this only when absolutely necessary, as it relies on
+// private implementation details of trivy.
+func (f privateField) get(obj any) (any, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.Type().Elem() != f.owner {
+		return nil, fmt.Errorf("cannot read %s.%s from a %T", f.owner, f.name, obj)
+	}
+
+	field := v.Elem().FieldByName(f.name)
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface(), nil
+}
@@ -0,0 +1,55 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package adapter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+)
+
+func TestReflectCheck(t *testing.T) {
+	if err := (Reflect{}).Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReflectReferenceParent(t *testing.T) {
+	parent, err := Reflect{}.ReferenceParent(&terraform.Reference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != "" {
+		t.Errorf("expected no parent, got %q", parent)
+	}
+
+	if _, err := (Reflect{}).ReferenceParent(nil); err == nil {
+		t.Error("expected an error for a nil reference")
+	}
+}
+
+func TestPrivateFieldErrors(t *testing.T) {
+	missing := privateField{
+		owner: reflect.TypeFor[terraform.Reference](),
+		name:  "doesNotExist",
+		typ:   reflect.TypeFor[string](),
+	}
+	if _, err := missing.get(&terraform.Reference{}); err == nil || !strings.Contains(err.Error(), `no field "doesNotExist"`) {
+		t.Errorf("expected a missing field error, got %v", err)
+	}
+
+	wrongType := privateField{
+		owner: reflect.TypeFor[terraform.Reference](),
+		name:  "parent",
+		typ:   reflect.TypeFor[int](),
+	}
+	if err := wrongType.check(); err == nil || !strings.Contains(err.Error(), "has type string, expected int") {
+		t.Errorf("expected a type mismatch error, got %v", err)
+	}
+
+	if _, err := referenceParent.get(terraform.Reference{}); err == nil {
+		t.Error("expected an error when reading from a value rather than a pointer")
+	}
+}
@@ -4,34 +4,52 @@ package converter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/Jeffail/gabs/v2"
 	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser"
 	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser/funcs"
 	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/cloud-custodian/tfparse/gotfparse/internal/adapter"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 )
 
-// Default to INFO level
-var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-	Level: slog.LevelInfo,
-}))
+// defaultLogger is used by converters that aren't given a logger of their
+// own. It defaults to INFO level.
+var defaultLogger atomic.Pointer[slog.Logger]
 
-// SetLogLevel sets the logging level
-func SetLogLevel(level slog.Level) {
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+func init() {
+	SetLogLevel(slog.LevelInfo)
+}
+
+// newStderrLogger returns a text logger that writes to stderr.
+func newStderrLogger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: level,
-	})
-	logger = slog.New(handler)
+	}))
+}
+
+// SetLogLevel sets the logging level of the default logger, which is used by
+// converters created afterwards without WithLogger or WithDebug.
+//
+// Deprecated: this affects every converter in the process, use WithLogger to
+// set the logger of a single converter instead.
+func SetLogLevel(level slog.Level) {
+	defaultLogger.Store(newStderrLogger(level))
 }
 
 type stringSet map[string]bool
@@ -61,12 +79,40 @@ type blockReferences struct {
 type referenceTracker struct {
 	// track blocks by their string reference
 	blocksByReference map[string]*terraform.Block
+	// track local values by their string reference, so references can be
+	// followed through them
+	localsByReference map[string]*terraform.Attribute
+	// track the data blocks scoped to check blocks by their string
+	// reference, as references to them keep the attribute that's referenced
+	scopedDataByReference map[string]*terraform.Block
 	// track all processed blocks that might have references
 	blocksWithReferences []*blockReferences
+	// track the blocks that reference each block, by block ID
+	referencedBy map[string][]map[string]any
+	// referencePath returns the fully qualified path of a reference
+	referencePath func(*terraform.Reference) string
+	// moduleBlock returns the module block that a block was loaded through
+	moduleBlock func(*terraform.Block) *terraform.Block
 }
 
 func (r *referenceTracker) AddBlock(b *terraform.Block) {
-	r.blocksByReference[b.FullName()] = b
+	name := r.getBlockFullName(b)
+	r.blocksByReference[name] = b
+
+	if b.Type() == "locals" {
+		// a locals block is named "locals", or "module.x.locals" in a module
+		for _, a := range b.GetAttributes() {
+			r.localsByReference[fmt.Sprintf("%s.%s", name, a.Name())] = a
+		}
+	}
+
+	if b.Type() == "check" {
+		for _, child := range getChildBlocks(b) {
+			if child.Type() == "data" {
+				r.scopedDataByReference[r.getBlockFullName(child)] = child
+			}
+		}
+	}
 }
 
 func (r *referenceTracker) AddBlockReferences(refs []string, blockMeta *map[string]any) {
@@ -74,32 +120,210 @@ func (r *referenceTracker) AddBlockReferences(refs []string, blockMeta *map[stri
 	r.blocksWithReferences = append(r.blocksWithReferences, &blockReferences{refs: refs, meta: blockMeta})
 }
 
+// AddReverseReferences records the blocks referenced by each of b's
+// attributes, keyed by attribute path, as being referenced by b. This must be
+// called once all blocks that may be referenced have been added.
+func (r *referenceTracker) AddReverseReferences(b *terraform.Block, attrRefs map[string][]string) {
+	for _, path := range slices.Sorted(maps.Keys(attrRefs)) {
+		seen := stringSet{}
+		for _, ref := range attrRefs[path] {
+			for _, target := range r.referencedBlocks(ref) {
+				if seen[target.ID()] || target.ID() == b.ID() {
+					continue
+				}
+				seen.Add(target.ID())
+
+				meta := r.getReferenceMeta(b)
+				meta["attribute"] = path
+				r.referencedBy[target.ID()] = append(r.referencedBy[target.ID()], meta)
+			}
+		}
+	}
+}
+
+// ResolveAttributeReferences returns the IDs of the blocks referenced by each
+// attribute in attrRefs, keyed by attribute path. Attributes that don't
+// reference any known blocks are left out.
+func (r *referenceTracker) ResolveAttributeReferences(attrRefs map[string][]string) map[string][]string {
+	resolved := make(map[string][]string)
+	for path, refs := range attrRefs {
+		seen := stringSet{}
+		ids := []string{}
+		for _, ref := range refs {
+			for _, target := range r.referencedBlocks(ref) {
+				if seen[target.ID()] {
+					continue
+				}
+				seen.Add(target.ID())
+				ids = append(ids, target.ID())
+			}
+		}
+		if len(ids) > 0 {
+			resolved[path] = ids
+		}
+	}
+	return resolved
+}
+
+// ReferencedBy returns the blocks that reference b, as recorded by
+// AddReverseReferences.
+func (r *referenceTracker) ReferencedBy(b *terraform.Block) []map[string]any {
+	return r.referencedBy[b.ID()]
+}
+
 // ProcessBlocksReferences includes a "references" entry in blocks metadata if
 // they have references to other blocks.  This must be called once all
-// references have been collected for all blocks.
+// blocks that may be referenced have been added. Processed blocks are
+// forgotten, so this can be called again as more blocks are visited.
+//
+// References through module outputs, module inputs and local values are
+// followed to the blocks that they are derived from, so a resource that uses
+// `module.bucket.arn` references the bucket inside of the module.
 func (r *referenceTracker) ProcessBlocksReferences() {
 	for _, blockRef := range r.blocksWithReferences {
 		refsMeta := [](map[string]any){}
+		seen := stringSet{}
 		for _, ref := range blockRef.refs {
-			if block, ok := r.blocksByReference[ref]; ok {
-				meta := map[string]any{
-					"id":    block.ID(),
-					"label": block.TypeLabel(),
-					"name":  block.NameLabel(),
+			for _, block := range r.referencedBlocks(ref) {
+				if seen[block.ID()] {
+					continue
 				}
-				refsMeta = append(refsMeta, meta)
+				seen.Add(block.ID())
+				refsMeta = append(refsMeta, r.getReferenceMeta(block))
 			}
 		}
 		if len(refsMeta) > 0 {
 			(*blockRef.meta)["references"] = refsMeta
 		}
 	}
+	r.blocksWithReferences = r.blocksWithReferences[:0]
+}
+
+// referencedBlocks returns the block that a reference names, if it's been
+// added, followed by the blocks that it's derived from.
+func (r *referenceTracker) referencedBlocks(ref string) []*terraform.Block {
+	var blocks []*terraform.Block
+	if block, ok := r.blocksByReference[ref]; ok {
+		blocks = append(blocks, block)
+	}
+	return append(blocks, r.resolveReference(ref, stringSet{})...)
 }
 
-func newReferenceTracker() referenceTracker {
+// getReferenceMeta describes a block in the "references" and
+// "referenced_by" entries of block metadata.
+func (r *referenceTracker) getReferenceMeta(b *terraform.Block) map[string]any {
+	meta := map[string]any{
+		"id":    b.ID(),
+		"label": b.TypeLabel(),
+		"name":  b.NameLabel(),
+	}
+	if moduleBlock := r.moduleBlock(b); moduleBlock != nil {
+		meta["module"] = moduleBlock.FullName()
+	}
+	return meta
+}
+
+// resolveReference returns the blocks that a reference is derived from,
+// following module outputs, module inputs and local values through to the
+// blocks that they refer to. seen guards against cycles between them.
+func (r *referenceTracker) resolveReference(ref string, seen stringSet) []*terraform.Block {
+	if seen[ref] {
+		return nil
+	}
+	seen.Add(ref)
+
+	if block, ok := r.blocksByReference[ref]; ok {
+		switch block.Type() {
+		case "output":
+			return r.resolveAttributeReferences(block.GetAttribute("value"), seen)
+		case "variable":
+			// the values of a module's variables are set by its module block
+			if moduleBlock := r.moduleBlock(block); moduleBlock != nil {
+				return r.resolveAttributeReferences(moduleBlock.GetAttribute(block.Label()), seen)
+			}
+			return nil
+		}
+		return []*terraform.Block{block}
+	}
+
+	if attr, ok := r.localsByReference[ref]; ok {
+		return r.resolveAttributeReferences(attr, seen)
+	}
+
+	if output := getModuleOutputName(ref); output != "" {
+		return r.resolveReference(output, seen)
+	}
+
+	if block, ok := r.scopedDataByReference[getDataBlockName(ref)]; ok {
+		return []*terraform.Block{block}
+	}
+
+	return nil
+}
+
+func (r *referenceTracker) resolveAttributeReferences(a *terraform.Attribute, seen stringSet) []*terraform.Block {
+	if a == nil {
+		return nil
+	}
+
+	var blocks []*terraform.Block
+	for _, ref := range a.AllReferences() {
+		blocks = append(blocks, r.resolveReference(r.referencePath(ref), seen)...)
+	}
+	return blocks
+}
+
+// getModuleOutputName returns the name of the output block that a reference
+// to a module's output refers to, such as "module.bucket.output.arn" for
+// "module.bucket.arn", or an empty string if it isn't a module reference.
+func getModuleOutputName(ref string) string {
+	parts := strings.Split(ref, ".")
+	for i := len(parts) - 3; i >= 0; i-- {
+		if parts[i] != "module" {
+			continue
+		}
+
+		// the key of a module with count or for_each follows the output name
+		module, name := parts[i+1], parts[i+2]
+		if idx := strings.Index(name, "["); idx >= 0 {
+			module, name = module+name[idx:], name[:idx]
+		}
+		if name == "output" {
+			return ""
+		}
+
+		return strings.Join(append(parts[:i:i], "module", module, "output", name), ".")
+	}
+	return ""
+}
+
+// getDataBlockName returns the name of the data block that a reference to
+// one of its attributes refers to, such as "data.http.site" for
+// "data.http.site.status_code", or an empty string if it isn't a reference to
+// a data block.
+func getDataBlockName(ref string) string {
+	parts := strings.Split(ref, ".")
+	for i := 0; i+2 < len(parts); i += 2 {
+		switch parts[i] {
+		case "module":
+			continue
+		case "data":
+			return strings.Join(parts[:i+3], ".")
+		}
+		break
+	}
+	return ""
+}
+
+func newReferenceTracker(referencePath func(*terraform.Reference) string, moduleBlock func(*terraform.Block) *terraform.Block) referenceTracker {
 	return referenceTracker{
-		blocksByReference:    make(map[string]*terraform.Block),
-		blocksWithReferences: []*blockReferences{},
+		blocksByReference:     make(map[string]*terraform.Block),
+		localsByReference:     make(map[string]*terraform.Attribute),
+		scopedDataByReference: make(map[string]*terraform.Block),
+		blocksWithReferences:  []*blockReferences{},
+		referencedBy:          make(map[string][]map[string]any),
+		referencePath:         referencePath,
+		moduleBlock:           moduleBlock,
 	}
 }
 
@@ -111,8 +335,11 @@ func newReferenceTracker() referenceTracker {
 // a tweaked version of that function here, rather than performing a local
 // replace on the HumanReadable() value. This is _probably_ the more stable
 // option, but it's still a hack.
-func getPath(r *terraform.Reference) string {
-	parent := getPrivateValue(r, "parent").(string)
+func (t *terraformConverter) getReferencePath(r *terraform.Reference) string {
+	parent, err := t.adapter.ReferenceParent(r)
+	if err != nil {
+		t.logger.Error("unable to get reference parent", "reference", r.String(), "error", err)
+	}
 	if parent == "" {
 		return r.String()
 	}
@@ -126,52 +353,231 @@ type terraformConverter struct {
 	stopOnError      bool
 	parserOptions    []parser.Option
 	referenceTracker referenceTracker
+	adapter          adapter.Terraform
+	diagnostics      *diagnostics
+	logger           *slog.Logger
+
+	// attributeReferences includes the blocks referenced by each attribute
+	// in block metadata
+	attributeReferences bool
+
+	// typedUnknowns represents unknown values with unknownValue
+	typedUnknowns bool
+
+	// conditionalBranches represents conditionals with unknown conditions by
+	// the values of their branches
+	conditionalBranches bool
+
+	// policyDocuments emulates aws_iam_policy_document data sources
+	policyDocuments bool
+
+	// fileDataSources emulates data sources that read the local filesystem
+	fileDataSources bool
+	fileSystem      fs.FS
+
+	// remoteStateFiles and remoteStateDir are local state files to read the
+	// outputs of terraform_remote_state data sources from
+	remoteStateFiles map[string]string
+	remoteStateDir   string
+	remoteStates     map[string]*terraformState
+
+	// stubsFile is the path of a file of stand-in values for data sources
+	stubsFile string
+	stubs     dataSourceStubs
+
+	// stateFile is the path of a state file to fill in apply time values from
+	stateFile string
+	state     *terraformState
+
+	// overrides caches the values from stubs, emulated data sources and state
+	// for each module, by module address
+	overrides map[string][]overrideLayer
+	// emulated holds the attributes of emulated data sources, by block ID
+	emulated map[string]map[string]cty.Value
+
+	// planFile is the path of the JSON output of a plan to fill in values from
+	planFile string
+	plan     *planValues
+	// blockIDs are the IDs of all blocks, which the parser uses as
+	// placeholders for attributes such as id and arn
+	blockIDs stringSet
+
+	// variableArgs are the variable files and values of the root module, in
+	// the order they were given
+	variableArgs []variableArg
+	// environ is the environment to read TF_VAR_ variables from
+	environ []string
+	// autoLoadTFVars loads the variable files that Terraform loads without
+	// being given them
+	autoLoadTFVars bool
+	// variableFiles are the variable files that were loaded, in order of
+	// precedence
+	variableFiles []string
+	// variableSources are where the values of root module variables came
+	// from, by variable name
+	variableSources map[string]string
+
+	// sources caches the contents of configuration files, by filename, to
+	// quote the source of expressions that can't be resolved
+	sources map[string][]byte
+
+	// functions caches the functions available to each module, by module
+	// address
+	functions map[string]map[string]function.Function
 }
 
 // VisitJSON visits each of the Terraform JSON blocks that the Terraform converter
 // has stored in memory and extracts addiontal metadata from the underlying defsec data
 // structure and embeds the metadata directly in to the JSON data.
 func (t *terraformConverter) VisitJSON() *gabs.Container {
+	// a background context is never cancelled, so there's no error to handle
+	jsonOut, _ := t.VisitJSONContext(context.Background())
+	return jsonOut
+}
+
+// VisitJSONContext is like VisitJSON, but stops and returns the context's
+// error if it is cancelled before all blocks have been visited.
+func (t *terraformConverter) VisitJSONContext(ctx context.Context) (*gabs.Container, error) {
 	jsonOut := gabs.New()
+	t.indexBlocks()
 
-	for _, m := range t.modules {
-		t.visitModule(m, jsonOut)
+	err := t.walkBlocks(ctx, func(key string, obj map[string]any) error {
+		return jsonOut.ArrayAppendP(obj, key)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Now that all blocks have been processed, fill metadata about related
 	// blocks for labels collected during visiting
 	t.referenceTracker.ProcessBlocksReferences()
 
-	return jsonOut
+	return jsonOut, nil
 }
 
-// visitModule takes a module and walks each of the blocks underneath it.
-func (t *terraformConverter) visitModule(m *terraform.Module, out *gabs.Container) {
-	path := t.getModulePath(m)
+// VisitNDJSON is like VisitJSONContext, but rather than building the output
+// in memory, it writes each block to w as soon as it has been visited. Each
+// line of output is a JSON object with a single key, which is the key of
+// the array that the block would have been appended to by VisitJSON.
+func (t *terraformConverter) VisitNDJSON(ctx context.Context, w io.Writer) error {
+	// Blocks are written before later blocks have been visited, which is
+	// fine as every block is indexed up front.
+	t.indexBlocks()
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return t.walkBlocks(ctx, func(key string, obj map[string]any) error {
+		t.referenceTracker.ProcessBlocksReferences()
+		return enc.Encode(map[string]any{key: obj})
+	})
+}
 
-	for _, b := range m.GetBlocks() {
-		t.visitBlock(b, path, out)
+// VariableFiles returns the variable files that the values of the root
+// module's variables were read from, including those that were loaded
+// automatically, from the lowest to the highest precedence.
+func (t *terraformConverter) VariableFiles() []string {
+	return append([]string{}, t.variableFiles...)
+}
+
+// Diagnostics returns the problems found while parsing and evaluating the
+// module. Blocks affected by an error may be missing or incomplete in the
+// JSON output.
+func (t *terraformConverter) Diagnostics() []Diagnostic {
+	return t.diagnostics.list()
+}
+
+// getLocalModuleAddresses returns the addresses of the module blocks with a
+// local source, such as "module.vpc", by the directory of their source.
+func (t *terraformConverter) getLocalModuleAddresses(rootDir string) map[string]string {
+	addresses := map[string]string{}
+	for _, m := range t.modules {
+		for _, b := range m.GetBlocks().OfType("module") {
+			source := b.GetAttribute("source")
+			if source == nil {
+				continue
+			}
+			val := source.Value()
+			if val.Type() != cty.String || !val.IsKnown() || val.IsNull() {
+				continue
+			}
+			dir := filepath.Dir(b.GetMetadata().Range().GetLocalFilename())
+			address := b.FullName()
+			if module := t.getModuleAddress(b); module != "" {
+				address = module + "." + address
+			}
+			addresses[filepath.Join(rootDir, dir, val.AsString())] = address
+		}
 	}
+	return addresses
 }
 
-// visitBlock takes a block, and either builds a json model of the resource or ignores it.
-func (t *terraformConverter) visitBlock(b *terraform.Block, parentPath string, jsonOut *gabs.Container) {
-	t.referenceTracker.AddBlock(b)
+// indexBlocks adds every block to the reference tracker, along with the
+// references made by each block's attributes, so that references in either
+// direction can be resolved before all blocks have been visited.
+func (t *terraformConverter) indexBlocks() {
+	t.referenceTracker.referencedBy = make(map[string][]map[string]any)
+	for _, m := range t.modules {
+		for _, b := range m.GetBlocks() {
+			t.referenceTracker.AddBlock(b)
+		}
+	}
+	for _, m := range t.modules {
+		for _, b := range m.GetBlocks() {
+			t.referenceTracker.AddReverseReferences(b, t.getAttributeReferences(b))
+		}
+	}
+}
+
+// walkBlocks visits each of the blocks in each module, and calls fn with the
+// JSON model of each block that isn't ignored, along with the key that it's
+// grouped under in the output.
+func (t *terraformConverter) walkBlocks(ctx context.Context, fn func(key string, obj map[string]any) error) error {
+	for _, m := range t.modules {
+		path := t.getModulePath(m)
 
+		for _, b := range m.GetBlocks() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key, obj, ok := t.visitBlock(b, path)
+			if !ok {
+				continue
+			}
+			if err := fn(key, obj); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// visitBlock takes a block, and either builds a json model of the resource or ignores it.
+func (t *terraformConverter) visitBlock(b *terraform.Block, parentPath string) (string, map[string]any, bool) {
 	switch b.Type() {
-	// These blocks don't have to conform to policies, and they don't have
-	//children that should have policies applied to them, so we ignore them.
-	case "data", "locals", "output", "provider", "terraform", "variable", "module", "moved", "resource":
-		json := t.buildBlock(b)
+	case "data", "locals", "output", "provider", "terraform", "variable", "module", "moved", "resource",
+		"import", "removed", "check", "ephemeral":
+		json := t.buildBlock(b, t.getPlanBlock(b))
 		meta := json["__tfmeta"].(map[string]interface{})
 
 		arrayKey := t.getPath(b, parentPath)
 
 		meta["path"] = arrayKey
 
+		if refs := t.referenceTracker.ReferencedBy(b); len(refs) > 0 {
+			meta["referenced_by"] = refs
+		}
+		if b.Type() == "check" {
+			t.addScopedBlockMeta(b, json, arrayKey)
+		}
+		if t.attributeReferences {
+			if refs := t.referenceTracker.ResolveAttributeReferences(t.getAttributeReferences(b)); len(refs) > 0 {
+				meta["attribute_references"] = refs
+			}
+		}
+
 		var key string
 		switch b.Type() {
-		case "data", "resource":
+		case "data", "resource", "ephemeral":
 			key = b.TypeLabel()
 			meta["type"] = b.Type()
 
@@ -179,9 +585,43 @@ func (t *terraformConverter) visitBlock(b *terraform.Block, parentPath string, j
 			key = b.Type()
 		}
 
-		jsonOut.ArrayAppendP(json, key)
+		return key, json, true
 	default:
-		logger.Info("unknown block type", "type", b.Type())
+		t.logger.Info("unknown block type", "type", b.Type())
+		return "", nil, false
+	}
+}
+
+// addScopedBlockMeta adds the path of each of the data and assert blocks
+// nested in a check block to their metadata, along with the blocks that
+// reference them, such as "check.health_check.data.http.site" or
+// "check.health_check.assert[0]".
+func (t *terraformConverter) addScopedBlockMeta(b *terraform.Block, obj map[string]any, path string) {
+	// nested blocks are numbered by type, as they're grouped by buildBlock
+	indexes := make(map[string]int)
+	for _, child := range getChildBlocks(b) {
+		key := child.Type()
+		i := indexes[key]
+		indexes[key]++
+
+		childObj, ok := obj[key].(map[string]any)
+		if items, isList := obj[key].([]any); isList {
+			childObj, ok = items[i].(map[string]any)
+		}
+		if !ok {
+			continue
+		}
+
+		meta := childObj["__tfmeta"].(map[string]any)
+		if key == "data" {
+			meta["path"] = fmt.Sprintf("%s.%s", path, child.GetMetadata().String())
+			meta["type"] = key
+		} else {
+			meta["path"] = fmt.Sprintf("%s.%s[%d]", path, key, i)
+		}
+		if refs := t.referenceTracker.ReferencedBy(child); len(refs) > 0 {
+			meta["referenced_by"] = refs
+		}
 	}
 }
 
@@ -226,13 +666,17 @@ func newBlockCollector() (add, dump) {
 }
 
 // buildBlock converts a terraform.Block's attributes and children to a json map.
-func (t *terraformConverter) buildBlock(b *terraform.Block) map[string]interface{} {
+// plan is the part of the plan for the block, if there is one.
+func (t *terraformConverter) buildBlock(b *terraform.Block, plan *planBlock) map[string]interface{} {
 	obj := make(map[string]interface{})
 
 	add, dump := newBlockCollector()
+	// nested blocks are numbered by type, as they're grouped by add
+	indexes := make(map[string]int)
 	for _, child := range getChildBlocks(b) {
 		key := child.Type()
-		add(key, t.buildBlock(child))
+		add(key, t.buildBlock(child, t.getNestedPlanBlock(plan, child, indexes[key])))
+		indexes[key]++
 	}
 	grouped := dump()
 	for key, result := range grouped {
@@ -240,19 +684,54 @@ func (t *terraformConverter) buildBlock(b *terraform.Block) map[string]interface
 	}
 
 	allRefs := stringSet{}
+	valueSources := map[string]any{}
 	for _, a := range b.GetAttributes() {
 		attrName := a.Name()
+		config := cty.NilVal
 		if b.Type() == "variable" && attrName == "type" {
 			// for variable type, the plain value is nil (unless the type has
 			// been provided in quotes), look at the variable type instead
 			var_type, _, _ := a.DecodeVarType()
 			obj[attrName] = var_type.FriendlyName()
+		} else if (b.Type() == "import" && attrName == "to") || (b.Type() == "removed" && attrName == "from") {
+			// the target of an import or removed block is the address of the
+			// resource, rather than its value
+			obj[attrName], _ = t.getTargetAddress(b)
+		} else if val, source, ok := t.getOverriddenValue(b, a); ok {
+			config = val
+			obj[attrName] = t.getNativeValue(a, val)
+			valueSources[attrName] = source
 		} else {
-			obj[attrName] = t.getAttributeValue(a)
+			config = t.getConfigValue(b, a)
+			obj[attrName] = t.getAttributeValue(b, a)
+		}
+
+		// the plan is more recent than any state, so its values take precedence
+		if val, source, ok := t.getPlanValue(plan, a, config, obj[attrName]); ok {
+			obj[attrName] = val
+			valueSources[attrName] = source
 		}
 
 		for _, ref := range a.AllReferences() {
-			allRefs.Add(getPath(ref))
+			allRefs.Add(t.getReferencePath(ref))
+		}
+		for _, ref := range t.getEphemeralReferences(b, a) {
+			allRefs.Add(ref)
+		}
+	}
+
+	// stubbed and emulated values are shown on the data source itself, as
+	// well as on the attributes that refer to it
+	for name, val := range t.getStubValues(b) {
+		if _, ok := obj[name]; !ok {
+			obj[name], _ = convertCtyToNativeValue(val)
+			valueSources[name] = valueSourceStub
+		}
+	}
+	for name, val := range t.getEmulatedValues(b) {
+		if _, ok := obj[name]; !ok {
+			obj[name], _ = convertCtyToNativeValue(val)
+			valueSources[name] = valueSourceEmulated
 		}
 	}
 
@@ -273,20 +752,87 @@ func (t *terraformConverter) buildBlock(b *terraform.Block) map[string]interface
 	if tl := b.TypeLabel(); tl != "" {
 		meta["label"] = tl
 	}
+	if len(valueSources) > 0 {
+		meta["value_sources"] = valueSources
+	}
+	if b.Type() == "variable" {
+		val, source := t.getVariableValue(b)
+		if val != cty.NilVal && t.typedUnknowns {
+			u := &unresolvedValues{typed: true}
+			meta["value"] = u.native(val, fmt.Sprintf("var.%s", b.Label()))
+		} else if val != cty.NilVal {
+			meta["value"], _ = convertCtyToNativeValue(val)
+		} else {
+			meta["value"] = nil
+		}
+		meta["value_source"] = source
+	}
+	if t.plan != nil {
+		if paths := t.plan.afterUnknown[t.getPlanAddress(b)]; len(paths) > 0 {
+			meta["after_unknown"] = paths
+		}
+	}
 	obj["__tfmeta"] = meta
 	return obj
 }
 
-// getAttributeValue returns the value for the attribute
-func (t *terraformConverter) getAttributeValue(a *terraform.Attribute) any {
+// getAttributeReferences returns the references made by each of a block's
+// attributes, including the attributes of nested blocks, keyed by the path of
+// the attribute within the block, such as "ingress[0].security_groups".
+func (t *terraformConverter) getAttributeReferences(b *terraform.Block) map[string][]string {
+	attrRefs := make(map[string][]string)
+	t.collectAttributeReferences(b, "", attrRefs)
+	return attrRefs
+}
+
+func (t *terraformConverter) collectAttributeReferences(b *terraform.Block, prefix string, attrRefs map[string][]string) {
+	for _, a := range b.GetAttributes() {
+		refs := stringSet{}
+		for _, ref := range a.AllReferences() {
+			refs.Add(t.getReferencePath(ref))
+		}
+		for _, ref := range t.getEphemeralReferences(b, a) {
+			refs.Add(ref)
+		}
+		if entries := refs.Entries(); len(entries) > 0 {
+			slices.Sort(entries)
+			attrRefs[prefix+a.Name()] = entries
+		}
+	}
+
+	// nested blocks are numbered by type, as they're grouped by buildBlock
+	indexes := make(map[string]int)
+	for _, child := range getChildBlocks(b) {
+		key := child.Type()
+		t.collectAttributeReferences(child, fmt.Sprintf("%s%s[%d].", prefix, key, indexes[key]), attrRefs)
+		indexes[key]++
+	}
+}
+
+// getAttributeValue returns the value for an attribute of a block
+func (t *terraformConverter) getAttributeValue(b *terraform.Block, a *terraform.Attribute) any {
 	// First try using the parsed value directly
 	val := a.Value()
 
+	if t.conditionalBranches && !val.IsWhollyKnown() {
+		if branches, ok := t.getConditionalBranches(b, a); ok {
+			return branches
+		}
+	}
+
+	if t.typedUnknowns && !val.IsWhollyKnown() {
+		return t.getPartialValue(b, a, val)
+	}
+
 	// Only attempt to handle functions manually if the value is null or not known
 	// This ensures we don't interfere with functions that have been successfully resolved
 	if val.IsNull() || !val.IsKnown() || !val.IsWhollyKnown() {
 		// Check if it's a function call that might have failed due to unresolvable variables
-		hclAttr := getPrivateValue(a, "hclAttribute").(*hcl.Attribute)
+		hclAttr, err := t.adapter.HCLAttribute(a)
+		if err != nil {
+			t.logger.Error("unable to get hcl attribute", "name", a.Name(), "error", err)
+			hclAttr = &hcl.Attribute{}
+		}
 
 		// Try different expression types in order of precedence
 		if templateExpr, isTemplate := hclAttr.Expr.(*hclsyntax.TemplateExpr); isTemplate {
@@ -298,7 +844,13 @@ func (t *terraformConverter) getAttributeValue(a *terraform.Attribute) any {
 		}
 
 		if funcExpr, isFuncCall := hclAttr.Expr.(*hclsyntax.FunctionCallExpr); isFuncCall {
-			return t.handleFunctionCall(funcExpr)
+			return t.handleFunctionCall(b, funcExpr)
+		}
+
+		if b.Type() == "assert" && !val.IsKnown() && hclAttr.Expr != nil {
+			// the assertions of check blocks are usually about values that
+			// are only known after apply, so they're kept as their source
+			return map[string]any{unresolvedKey: t.expressionSource(hclAttr.Expr)}
 		}
 	}
 
@@ -311,6 +863,60 @@ func (t *terraformConverter) getAttributeValue(a *terraform.Attribute) any {
 	return a.GetRawValue()
 }
 
+// getNativeValue converts the value of an attribute to a value that can be
+// converted to JSON. Unknown values are null, unless typed unknowns are
+// enabled.
+func (t *terraformConverter) getNativeValue(a *terraform.Attribute, val cty.Value) any {
+	if !t.typedUnknowns || val.IsWhollyKnown() {
+		raw, _ := convertCtyToNativeValue(val)
+		return raw
+	}
+
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		t.logger.Error("unable to get hcl attribute", "name", a.Name(), "error", err)
+		raw, _ := convertCtyToNativeValue(val)
+		return raw
+	}
+	u := &unresolvedValues{typed: true, references: t.expressionReferences(hclAttr.Expr)}
+	return u.native(val, t.expressionSource(hclAttr.Expr))
+}
+
+// getPartialValue evaluates an attribute that isn't wholly known part by
+// part, with each unknown part represented by unknownValue.
+func (t *terraformConverter) getPartialValue(b *terraform.Block, a *terraform.Attribute, val cty.Value) any {
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil || b.Context() == nil {
+		return t.getNativeValue(a, val)
+	}
+
+	u := &unresolvedValues{typed: true, references: t.expressionReferences(hclAttr.Expr)}
+	partial := t.partialValue(hclAttr.Expr, t.getFunctions(b), t.getEvalContext(b), u, cty.DynamicPseudoType)
+	return u.native(partial, t.expressionSource(hclAttr.Expr))
+}
+
+// getConditionalBranches returns the values of both branches of an attribute
+// that's a conditional expression with a condition that isn't known, such as
+// {"__one_of__": ["aws:kms", "AES256"], "condition": "var.enabled"}.
+func (t *terraformConverter) getConditionalBranches(b *terraform.Block, a *terraform.Attribute) (any, bool) {
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil || b.Context() == nil {
+		return nil, false
+	}
+	return t.oneOf(hclAttr.Expr, t.getFunctions(b), t.getEvalContext(b))
+}
+
+// getEvalContext returns the context to evaluate the expressions of a block
+// in, where values from stubs, emulated data sources and state take
+// precedence.
+func (t *terraformConverter) getEvalContext(b *terraform.Block) *hcl.EvalContext {
+	ctx := b.Context().Inner()
+	for _, layer := range t.getModuleOverrides(b) {
+		ctx = newOverrideContext(ctx, layer.vars)
+	}
+	return ctx
+}
+
 // handleTemplateExpression processes string interpolation expressions
 func (t *terraformConverter) handleTemplateExpression(a *terraform.Attribute, templateExpr *hclsyntax.TemplateExpr) any {
 	// For string interpolation that couldn't be fully resolved,
@@ -322,7 +928,7 @@ func (t *terraformConverter) handleTemplateExpression(a *terraform.Attribute, te
 	}
 
 	// If raw value isn't helpful, try to reconstruct the template from its parts
-	reconstructed := reconstructTemplate(templateExpr)
+	reconstructed := t.reconstructTemplate(templateExpr)
 	if reconstructed != "" {
 		return reconstructed
 	}
@@ -342,8 +948,10 @@ func (t *terraformConverter) handleScopeTraversal(traversalExpr *hclsyntax.Scope
 	var refString strings.Builder
 	var resourceType, resourceName string
 
-	// First determine if this is a data source reference or direct resource reference
-	isData := traversalExpr.Traversal[0].(hcl.TraverseRoot).Name == "data"
+	// First determine if this is a data source or ephemeral resource reference,
+	// or a direct resource reference
+	root := traversalExpr.Traversal[0].(hcl.TraverseRoot).Name
+	isData := root == "data" || root == "ephemeral"
 
 	// Build the full reference string and extract key components
 	for i, step := range traversalExpr.Traversal {
@@ -361,7 +969,8 @@ func (t *terraformConverter) handleScopeTraversal(traversalExpr *hclsyntax.Scope
 
 			// Extract resource type and name based on position in traversal
 			if isData {
-				// For data sources: data.aws_type.name...
+				// For data sources: data.aws_type.name..., and likewise for
+				// ephemeral resources
 				if i == 1 {
 					resourceType = s.Name // Second part is the resource type (aws_type)
 				} else if i == 2 {
@@ -426,20 +1035,45 @@ func (t *terraformConverter) handleScopeTraversal(traversalExpr *hclsyntax.Scope
 }
 
 // handleFunctionCall processes function call expressions
-func (t *terraformConverter) handleFunctionCall(funcExpr *hclsyntax.FunctionCallExpr) any {
-	logger.Debug("Function call detected", "name", funcExpr.Name, "argCount", len(funcExpr.Args))
+func (t *terraformConverter) handleFunctionCall(b *terraform.Block, funcExpr *hclsyntax.FunctionCallExpr) any {
+	t.logger.Debug("Function call detected", "name", funcExpr.Name, "argCount", len(funcExpr.Args))
 
 	// Get the function from Trivy's function map
-	functions := parser.Functions(os.DirFS("."), ".")
-	if fn, exists := functions[funcExpr.Name]; exists {
-		return t.handleGenericFunction(funcExpr, fn)
+	functions := t.getFunctions(b)
+	if _, exists := functions[funcExpr.Name]; exists {
+		return t.handleGenericFunction(b, funcExpr, functions)
 	}
 
 	return nil
 }
 
-// reconstructTemplate tries to reconstruct a template string from its parts
-func reconstructTemplate(expr *hclsyntax.TemplateExpr) string {
+// getFunctions returns the functions available to the module of a block.
+// Like the parser's own, the file functions resolve relative paths from the
+// module's directory rather than the working directory of the process.
+func (t *terraformConverter) getFunctions(b *terraform.Block) map[string]function.Function {
+	module := t.getModuleAddress(b)
+	if functions, ok := t.functions[module]; ok {
+		return functions
+	}
+
+	moduleDir := "."
+	if b.Context() != nil {
+		if pathVal := lookupVariable(b.Context().Inner(), "path"); pathVal != cty.NilVal && pathVal.Type().IsObjectType() && pathVal.Type().HasAttribute("module") {
+			if dir := pathVal.GetAttr("module"); dir.Type() == cty.String && dir.IsKnown() && !dir.IsNull() {
+				moduleDir = t.fsName(dir.AsString())
+			}
+		}
+	}
+
+	functions := parser.Functions(t.fileSystem, moduleDir)
+	t.functions[module] = functions
+	return functions
+}
+
+// reconstructTemplate tries to reconstruct a template string from its parts.
+// Interpolations are written with the source of their expressions, as it's
+// written in the file, such as ${var.env == "prod" ? 3 : 1}.
+func (t *terraformConverter) reconstructTemplate(expr *hclsyntax.TemplateExpr) string {
 	var templateParts []string
 
 	for _, part := range expr.Parts {
@@ -449,37 +1083,10 @@ func reconstructTemplate(expr *hclsyntax.TemplateExpr) string {
 			if p.Val.Type() == cty.String {
 				templateParts = append(templateParts, p.Val.AsString())
 			}
-		case *hclsyntax.ScopeTraversalExpr:
-			// For variable references like ${data.aws_caller_identity.current.account_id}
-			// Try to get a simple string representation of the traversal
-			var sb strings.Builder
-			sb.WriteString("${")
-
-			// Simple concatenation of traversal parts
-			for i, step := range p.Traversal {
-				if i > 0 {
-					if _, ok := step.(hcl.TraverseAttr); ok {
-						sb.WriteString(".")
-					}
-				}
-
-				switch s := step.(type) {
-				case hcl.TraverseRoot:
-					sb.WriteString(s.Name)
-				case hcl.TraverseAttr:
-					sb.WriteString(s.Name)
-				case hcl.TraverseIndex:
-					sb.WriteString("[")
-					appendTraverseIndexValue(&sb, s.Key)
-					sb.WriteString("]")
-				}
-			}
-
-			sb.WriteString("}")
-			templateParts = append(templateParts, sb.String())
 		default:
-			// For other types of expressions inside ${...} that we can't easily reconstruct
-			templateParts = append(templateParts, "${...}")
+			// For references like ${data.aws_caller_identity.current.account_id}
+			// and any other expressions, such as conditionals and function calls
+			templateParts = append(templateParts, fmt.Sprintf("${%s}", t.expressionSource(part)))
 		}
 	}
 
@@ -502,36 +1109,6 @@ func appendTraverseIndexValue(sb *strings.Builder, key cty.Value) {
 	}
 }
 
-// findVariableBlock finds a variable block by name
-func (t *terraformConverter) findVariableBlock(name string) *terraform.Block {
-	for _, m := range t.modules {
-		for _, block := range m.GetBlocks() {
-			if block.Type() == "variable" && block.Label() == name {
-				return block
-			}
-		}
-	}
-	return nil
-}
-
-// findLocalsBlock finds a locals block that contains a specific attribute
-func (t *terraformConverter) findLocalsBlock(name string) *terraform.Attribute {
-	logger.Debug("Looking for local", "name", name)
-	for _, m := range t.modules {
-		for _, block := range m.GetBlocks() {
-			if block.Type() == "locals" {
-				logger.Debug("Found locals block")
-				if attr := block.GetAttribute(name); attr != nil {
-					logger.Debug("Found attribute in locals block", "name", name)
-					return attr
-				}
-			}
-		}
-	}
-	logger.Debug("Local not found", "name", name)
-	return nil
-}
-
 // convertCtyToNativeValue converts a `cty.Value`, used by the
 // aquasecurity/defsec library, to a value that can be converted into json by
 // the Jeffail/gabs library.
@@ -660,40 +1237,238 @@ func getChildBlocks(b *terraform.Block) []*terraform.Block {
 // A TerraformConverter loads the HCL from the filePath and parses it in to memory as "blocks".
 // These blocks get extrated as JSON structured data for use by other tools.
 func NewTerraformConverter(filePath string, opts ...TerraformConverterOption) (*terraformConverter, error) {
+	return NewTerraformConverterWithContext(context.Background(), filePath, opts...)
+}
+
+// NewTerraformConverterWithContext is like NewTerraformConverter, but returns
+// the context's error if it is cancelled or times out before the module has
+// been parsed and evaluated. A parse that times out stops at the next file it
+// reads, or the next step of parsing, but may keep evaluating the module in
+// the background until then; see runWithContext.
+func NewTerraformConverterWithContext(ctx context.Context, filePath string, opts ...TerraformConverterOption) (*terraformConverter, error) {
 	tfc := &terraformConverter{
-		filePath:         filePath,
-		debug:            false,
-		stopOnError:      false,
-		parserOptions:    []parser.Option{},
-		referenceTracker: newReferenceTracker(),
+		filePath:        filePath,
+		debug:           false,
+		stopOnError:     false,
+		parserOptions:   []parser.Option{},
+		adapter:         adapter.Reflect{},
+		diagnostics:     &diagnostics{},
+		overrides:       make(map[string][]overrideLayer),
+		emulated:        make(map[string]map[string]cty.Value),
+		remoteStates:    make(map[string]*terraformState),
+		environ:         os.Environ(),
+		autoLoadTFVars:  true,
+		variableSources: make(map[string]string),
+		sources:         make(map[string][]byte),
+		functions:       make(map[string]map[string]function.Function),
+	}
+	tfc.referenceTracker = newReferenceTracker(tfc.getReferencePath, tfc.getModuleBlock)
+
+	if err := tfc.adapter.Check(); err != nil {
+		return nil, err
 	}
 
 	for _, opt := range opts {
 		opt(tfc)
 	}
 
-	fileSystem := newRelativeResolveFs(filePath)
+	if tfc.logger == nil {
+		if tfc.debug {
+			tfc.logger = newStderrLogger(slog.LevelDebug)
+		} else {
+			tfc.logger = defaultLogger.Load()
+		}
+	}
 
-	p := parser.New(fileSystem, "", tfc.parserOptions...)
-	if err := p.ParseFS(context.TODO(), "."); err != nil {
-		return nil, err
+	// Collect the problems that the parser logs as diagnostics. Its log
+	// records are only shown when debugging.
+	parserLogHandler := slog.DiscardHandler
+	if tfc.debug {
+		parserLogHandler = tfc.logger.Handler()
+	}
+	parserLogger := slog.New(newDiagnosticsHandler(parserLogHandler, tfc.diagnostics))
+	tfc.parserOptions = append(tfc.parserOptions, parser.OptionWithLogger(parserLogger))
+
+	tfc.fileSystem = newRelativeResolveFs(filePath)
+
+	// the files that are given are read first, so that a path that is wrong
+	// fails before the module is parsed
+	var err error
+	if tfc.planFile != "" {
+		if tfc.plan, err = readPlanFile(resolvePath(filePath, tfc.planFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	if tfc.stubsFile != "" {
+		if tfc.stubs, err = readDataSourceStubs(resolvePath(filePath, tfc.stubsFile)); err != nil {
+			return nil, err
+		}
 	}
 
-	m, err := p.EvaluateAll(context.TODO())
+	if tfc.stateFile != "" {
+		if tfc.state, err = readStateFile(resolvePath(filePath, tfc.stateFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	p := parser.New(contextFS{FS: tfc.fileSystem, ctx: ctx}, "", tfc.parserOptions...)
+	m, err := runWithContext(ctx, func() (terraform.Modules, error) {
+		if err := p.ParseFS(ctx, "."); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// the values of variables depend on their declarations
+		vars, err := tfc.loadVariables(p.Files(), parserLogger)
+		if err != nil {
+			return nil, err
+		}
+		parser.OptionsWithTfVars(vars)(p)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return p.EvaluateAll(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	tfc.modules = m
+	tfc.diagnostics.setModulePaths(tfc.getLocalModuleAddresses(filePath))
 
 	return tfc, nil
 }
 
+// runWithContext calls fn, and returns early with the context's error if the
+// context is done before fn returns.
+//
+// The parser is given the context, and its filesystem stops opening files
+// once the context is done, but it doesn't check for cancellation while it
+// evaluates a module. Go can't stop a goroutine, so a pathological module can
+// keep fn busy after the context is done. In that case fn is left to finish
+// in the background and its result is discarded.
+func runWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// contextFS is a filesystem that stops opening files once its context is
+// done, so that a parse that timed out stops at the next file it reads.
+type contextFS struct {
+	fs.FS
+	ctx context.Context
+}
+
+func (c contextFS) Open(name string) (fs.File, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.FS.Open(name)
+}
+
+// Path returns the real path of the filesystem, which the file functions of
+// the parser use, if it has one.
+func (c contextFS) Path() string {
+	if pathFS, ok := c.FS.(interface{ Path() string }); ok {
+		return pathFS.Path()
+	}
+	return ""
+}
+
 // SetDebug is a TerraformConverter option that is uesd to the debug output in the underlying defsec parser.
+// Unless a logger is set with SetLogger, debug messages are written to stderr.
 func (t *terraformConverter) SetDebug() {
-	// Enable debug logging
-	SetLogLevel(slog.LevelDebug)
-	t.parserOptions = append(t.parserOptions, parser.OptionWithLogger(logger))
+	t.debug = true
+}
+
+// SetLogger is a TerraformConverter option that sets the logger used by this converter, and by the underlying
+// defsec parser when debugging.
+func (t *terraformConverter) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// SetAttributeReferences is a TerraformConverter option that includes the IDs of the blocks referenced by each
+// attribute, keyed by attribute path, in the "attribute_references" entry of block metadata.
+func (t *terraformConverter) SetAttributeReferences() {
+	t.attributeReferences = true
+}
+
+// SetTypedUnknowns is a TerraformConverter option that represents every unknown value as an object with
+// "__unknown__" set, along with its type, source, references and refinements.
+func (t *terraformConverter) SetTypedUnknowns() {
+	t.typedUnknowns = true
+}
+
+// SetConditionalBranches is a TerraformConverter option that represents conditional expressions with unknown
+// conditions as an object with "__one_of__" set to the values of their branches, along with the condition.
+func (t *terraformConverter) SetConditionalBranches() {
+	t.conditionalBranches = true
+}
+
+// SetPolicyDocuments is a TerraformConverter option that evaluates aws_iam_policy_document data sources, rendering
+// their json and minified_json attributes like the AWS provider.
+func (t *terraformConverter) SetPolicyDocuments() {
+	t.policyDocuments = true
+}
+
+// SetFileDataSources is a TerraformConverter option that evaluates the archive_file, local_file and
+// local_sensitive_file data sources by reading the local filesystem.
+func (t *terraformConverter) SetFileDataSources() {
+	t.fileDataSources = true
+}
+
+// SetRemoteStateFiles is a TerraformConverter option that reads the outputs of terraform_remote_state data
+// sources from local state files, keyed by backend and key such as "s3:network/terraform.tfstate".
+func (t *terraformConverter) SetRemoteStateFiles(files map[string]string) {
+	if t.remoteStateFiles == nil {
+		t.remoteStateFiles = map[string]string{}
+	}
+	maps.Copy(t.remoteStateFiles, files)
+}
+
+// SetRemoteStateDir is a TerraformConverter option that reads the outputs of terraform_remote_state data sources
+// from the state files in a directory, by workspace name.
+func (t *terraformConverter) SetRemoteStateDir(dir string) {
+	t.remoteStateDir = dir
+}
+
+// SetDataSourceStubs is a TerraformConverter option that replaces the attributes of data sources with stand-in
+// values from a YAML or JSON file, such as the account ID of aws_caller_identity.
+func (t *terraformConverter) SetDataSourceStubs(path string) {
+	t.stubsFile = path
+}
+
+// SetStateFile is a TerraformConverter option that fills in values that aren't known until apply time, such as
+// the attributes of data sources, from a terraform.tfstate file.
+func (t *terraformConverter) SetStateFile(path string) {
+	t.stateFile = path
+}
+
+// SetPlanFile is a TerraformConverter option that fills in values that aren't known from configuration from the
+// JSON output of `terraform show -json` for a plan.
+func (t *terraformConverter) SetPlanFile(path string) {
+	t.planFile = path
 }
 
 // SetStopOnHCLError is a TerraformConverter option that is used to stop the underlying defsec parser when an
@@ -709,7 +1484,29 @@ func (t *terraformConverter) SetAllowDownloads(allowed bool) {
 
 // SetTFVarsPaths is a TerraformConverter option that sets a variables file for HCL interpolation.
 func (t *terraformConverter) SetTFVarsPaths(paths ...string) {
-	t.parserOptions = append(t.parserOptions, parser.OptionWithTFVarsPaths(paths...))
+	for _, path := range paths {
+		t.variableArgs = append(t.variableArgs, variableArg{file: path})
+	}
+}
+
+// SetVariables is a TerraformConverter option that sets the values of root module variables, like the -var
+// option of terraform plan.
+func (t *terraformConverter) SetVariables(vars map[string]string) {
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		t.variableArgs = append(t.variableArgs, variableArg{name: name, value: vars[name]})
+	}
+}
+
+// SetEnvVariables is a TerraformConverter option that reads TF_VAR_ variables from the given environment rather
+// than the process environment.
+func (t *terraformConverter) SetEnvVariables(environ []string) {
+	t.environ = slices.Clone(environ)
+}
+
+// SetAutoLoadTFVars is a TerraformConverter option that sets whether the terraform.tfvars,
+// terraform.tfvars.json and *.auto.tfvars(.json) files of the root module are loaded, like Terraform does.
+func (t *terraformConverter) SetAutoLoadTFVars(enabled bool) {
+	t.autoLoadTFVars = enabled
 }
 
 // SetWorkspaceName is a TerraformConverter option that sets the value for the workspace name.
@@ -717,16 +1514,24 @@ func (t *terraformConverter) SetWorkspaceName(workspace string) {
 	t.parserOptions = append(t.parserOptions, parser.OptionWithWorkspaceName(workspace))
 }
 
-func getModuleName(b *terraform.Block) string {
-	// This field is unexported, but necessary to generate the path of the
-	// module. Hopefully aquasecurity/defsec exports this in a future release.
-	moduleBlock := getPrivateValue(b, "moduleBlock").(*terraform.Block)
+// getModuleBlock returns the module block that a block was loaded through, or
+// nil for blocks in the root module.
+func (t *terraformConverter) getModuleBlock(b *terraform.Block) *terraform.Block {
+	moduleBlock, err := t.adapter.ModuleBlock(b)
+	if err != nil {
+		t.logger.Error("unable to get module block", "block", b.FullName(), "error", err)
+	}
+	return moduleBlock
+}
+
+func (t *terraformConverter) getModuleName(b *terraform.Block) string {
+	moduleBlock := t.getModuleBlock(b)
 	if moduleBlock == nil {
 		return ""
 	}
 
 	moduleName := moduleBlock.LocalName()
-	parentName := getModuleName(moduleBlock)
+	parentName := t.getModuleName(moduleBlock)
 	if parentName != "" {
 		moduleName = fmt.Sprintf("%s.%s", parentName, moduleName)
 	}
@@ -740,7 +1545,7 @@ func getModuleName(b *terraform.Block) string {
 func (t *terraformConverter) getModulePath(m *terraform.Module) string {
 	prefixes := make(map[string]struct{})
 	for _, b := range m.GetBlocks() {
-		moduleName := getModuleName(b)
+		moduleName := t.getModuleName(b)
 		if moduleName != "" {
 			prefixes[moduleName] = struct{}{}
 		}
@@ -763,6 +1568,19 @@ func (t *terraformConverter) getModulePath(m *terraform.Module) string {
 // array called "lambda", which was created inside a module called "notify_slack_qa".
 func (t *terraformConverter) getPath(b *terraform.Block, parentPath string) string {
 	blockName := b.GetMetadata().String()
+	switch b.Type() {
+	case "ephemeral":
+		blockName = getEphemeralName(b)
+	case "import", "removed":
+		// these blocks have no labels, so they're told apart by their target,
+		// such as "import.aws_instance.web"
+		if address, ok := t.getTargetAddress(b); ok {
+			blockName = fmt.Sprintf("%s.%s", b.Type(), address)
+		} else {
+			r := b.GetMetadata().Range()
+			blockName = fmt.Sprintf("%s.%s:%d", b.Type(), r.GetLocalFilename(), r.GetStartLine())
+		}
+	}
 	if parentPath == "" {
 		return blockName
 	}
@@ -770,7 +1588,85 @@ func (t *terraformConverter) getPath(b *terraform.Block, parentPath string) stri
 	return fmt.Sprintf("%s.%s", parentPath, blockName)
 }
 
-func getRootPath(ts hcl.Traversal) string {
+// getTargetAddress returns the address of the resource that an import or
+// removed block applies to, as it's written, such as "aws_instance.web".
+func (t *terraformConverter) getTargetAddress(b *terraform.Block) (string, bool) {
+	name := "to"
+	if b.Type() == "removed" {
+		name = "from"
+	}
+	a := b.GetAttribute(name)
+	if a == nil {
+		return "", false
+	}
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		t.logger.Error("unable to get hcl attribute", "name", a.Name(), "error", err)
+		return "", false
+	}
+	return t.expressionSource(hclAttr.Expr), true
+}
+
+// getBlockFullName returns the fully qualified name of a block, as used to
+// track references between blocks.
+func (r *referenceTracker) getBlockFullName(b *terraform.Block) string {
+	if b.Type() != "ephemeral" {
+		return b.FullName()
+	}
+
+	name := getEphemeralName(b)
+	if moduleBlock := r.moduleBlock(b); moduleBlock != nil {
+		return fmt.Sprintf("%s.%s", moduleBlock.FullName(), name)
+	}
+	return name
+}
+
+// getEphemeralName returns the local name of an ephemeral resource, such as
+// "ephemeral.aws_secretsmanager_secret_version.db_password".
+//
+// The upstream parser doesn't know about ephemeral resources. It treats them
+// as a resource with a type of "ephemeral", which drops the name label from
+// the block's reference, so we build the name from the labels instead.
+func getEphemeralName(b *terraform.Block) string {
+	return fmt.Sprintf("ephemeral.%s.%s%s", b.TypeLabel(), b.NameLabel(), b.Reference().KeyBracketed())
+}
+
+// getEphemeralReferences returns the fully qualified names of the ephemeral
+// resources referenced by an attribute. These are skipped by
+// terraform.Attribute.AllReferences for the same reason as getEphemeralName.
+func (t *terraformConverter) getEphemeralReferences(b *terraform.Block, a *terraform.Attribute) []string {
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		t.logger.Error("unable to get hcl attribute", "name", a.Name(), "error", err)
+		return nil
+	}
+
+	var refs []string
+	for _, traversal := range hclAttr.Expr.Variables() {
+		if traversal.RootName() != "ephemeral" || len(traversal) < 3 {
+			continue
+		}
+		typeLabel, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		nameLabel, ok := traversal[2].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+
+		ref := fmt.Sprintf("ephemeral.%s.%s", typeLabel.Name, nameLabel.Name)
+		if moduleBlock := t.getModuleBlock(b); moduleBlock != nil {
+			ref = fmt.Sprintf("%s.%s", moduleBlock.FullName(), ref)
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// getRootPath returns the path of a traversal, such as "var.list[0]". It
+// returns an error if a step of the traversal can't be written as a path.
+func getRootPath(ts hcl.Traversal) (string, error) {
 	var sb strings.Builder
 	for _, t := range ts {
 		switch tt := t.(type) {
@@ -780,134 +1676,69 @@ func getRootPath(ts hcl.Traversal) string {
 		case hcl.TraverseRoot:
 			sb.WriteString(tt.Name)
 		case hcl.TraverseIndex:
+			key, err := convertCtyToString(tt.Key)
+			if err != nil {
+				return "", err
+			}
 			sb.WriteString("[")
-			sb.WriteString(convertCtyToString(tt.Key))
+			sb.WriteString(key)
 			sb.WriteString("]")
 		case hcl.TraverseSplat:
 			sb.WriteString("[*]")
 		default:
-			panic(tt)
+			return "", fmt.Errorf("unsupported traversal step %T", t)
 		}
 	}
-	return sb.String()
+	return sb.String(), nil
 }
 
-func convertCtyToString(key cty.Value) string {
-	val, ok := convertCtyToNativeValue(key)
-	if !ok {
-		return ""
+// convertCtyToString returns an index key as it's written in a path. Numbers
+// that aren't integers, such as 1.5, are written in full.
+func convertCtyToString(key cty.Value) (string, error) {
+	key, _ = key.UnmarkDeep()
+	if !key.IsKnown() || key.IsNull() {
+		return "", fmt.Errorf("index key %#v is not known", key)
 	}
 
-	switch d := val.(type) {
-	case string:
-		return d
-	case int, int8, int16, int32, int64, float32, float64:
-		num := d.(int64)
-		return strconv.FormatInt(num, 10)
-	case bool:
-		return strconv.FormatBool(d)
+	switch key.Type() {
+	case cty.String:
+		return key.AsString(), nil
+	case cty.Number:
+		return key.AsBigFloat().Text('f', -1), nil
+	case cty.Bool:
+		return strconv.FormatBool(key.True()), nil
 	default:
-		panic(d)
+		return "", fmt.Errorf("unsupported index key of type %s", key.Type().FriendlyName())
 	}
 }
 
-// handleGenericFunction processes any non-merge function
-func (t *terraformConverter) handleGenericFunction(funcExpr *hclsyntax.FunctionCallExpr, fn function.Function) interface{} {
-	logger.Debug("Processing function call", "name", funcExpr.Name, "argCount", len(funcExpr.Args))
-
-	// Prepare arguments for the function
-	var args []cty.Value
-
-	// Process each argument
-	for _, arg := range funcExpr.Args {
-		switch expr := arg.(type) {
-		case *hclsyntax.ObjectConsExpr:
-			// For object expressions, extract keys and values
-			attrs := make(map[string]cty.Value)
-			for _, item := range expr.Items {
-				key := t.extractKey(item.KeyExpr)
-				if key == "" {
-					continue
-				}
-
-				// Handle different value expression types
-				switch valExpr := item.ValueExpr.(type) {
-				case *hclsyntax.LiteralValueExpr:
-					// Direct literal value
-					attrs[key] = valExpr.Val
-				case *hclsyntax.TemplateExpr:
-					// Template with literals
-					if len(valExpr.Parts) == 1 {
-						if lit, ok := valExpr.Parts[0].(*hclsyntax.LiteralValueExpr); ok {
-							attrs[key] = lit.Val
-							continue
-						}
-					}
-					// Use null for complex templates instead of a placeholder
-					attrs[key] = cty.NullVal(cty.String)
-				case *hclsyntax.ScopeTraversalExpr:
-					// If the value is a data reference, use null
-					attrs[key] = cty.NullVal(cty.String)
-				default:
-					// For other expression types, just use null value
-					// This preserves the key while setting a null value
-					attrs[key] = cty.NullVal(cty.String)
-				}
-			}
-			if len(attrs) > 0 {
-				args = append(args, cty.ObjectVal(attrs))
-			}
+// traversalPath returns the path of a traversal, or its source text if it
+// can't be written as a path.
+func (t *terraformConverter) traversalPath(traversal hcl.Traversal) string {
+	if path, err := getRootPath(traversal); err == nil {
+		return path
+	}
+	return t.rangeSource(traversal.SourceRange())
+}
 
-		case *hclsyntax.ScopeTraversalExpr:
-			// For variable references, try to use default values
-			rootName := expr.Traversal.RootName()
-			if rootName == "var" && len(expr.Traversal) > 1 {
-				varName := expr.Traversal[1].(hcl.TraverseAttr).Name
-				if varBlock := t.findVariableBlock(varName); varBlock != nil {
-					if defaultAttr := varBlock.GetAttribute("default"); defaultAttr != nil {
-						args = append(args, defaultAttr.Value())
-						continue
-					} else {
-						// Variable exists but has no default - use an empty object
-						// This allows functions to still operate on the variable
-						args = append(args, cty.EmptyObjectVal)
-						continue
-					}
-				} else {
-					// Variable not found - use an empty object
-					args = append(args, cty.EmptyObjectVal)
-					continue
-				}
-			} else if rootName == "local" && len(expr.Traversal) > 1 {
-				// Handle local references
-				localName := expr.Traversal[1].(hcl.TraverseAttr).Name
-				if localAttr := t.findLocalsBlock(localName); localAttr != nil {
-					args = append(args, localAttr.Value())
-					continue
-				} else {
-					// Local not found - use an empty object
-					args = append(args, cty.EmptyObjectVal)
-					continue
-				}
-			}
-			// If not a variable or something more complex, include the traversal path in the value
-			// This preserves important reference information for downstream processors
-			getRootPath(expr.Traversal)
-			// Use null for all unresolvable references so they're included in the final output
-			args = append(args, cty.NullVal(cty.String))
-		}
+// handleGenericFunction calls a function in the module of the block, with
+// markers in place of the arguments that aren't known where it allows them.
+func (t *terraformConverter) handleGenericFunction(b *terraform.Block, funcExpr *hclsyntax.FunctionCallExpr, functions map[string]function.Function) interface{} {
+	t.logger.Debug("Processing function call", "name", funcExpr.Name, "argCount", len(funcExpr.Args))
+	if b.Context() == nil {
+		return nil
 	}
 
-	// Call the function with our arguments
-	if len(args) > 0 {
-		result, err := fn.Call(args)
-		if err == nil {
-			if raw, ok := convertCtyToNativeValue(result); ok {
-				return raw
-			}
+	ctx := t.getEvalContext(b)
+	u := &unresolvedValues{typed: t.typedUnknowns, references: t.expressionReferences(funcExpr)}
+	result, ok := t.callPartially(funcExpr, functions, ctx, u)
+	if !ok {
+		var diags hcl.Diagnostics
+		if result, diags = funcExpr.Value(ctx); diags.HasErrors() {
+			return nil
 		}
 	}
-	return nil
+	return u.native(result, t.expressionSource(funcExpr))
 }
 
 // extractKey extracts a string key from a key expression
@@ -0,0 +1,719 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+var updateGoldens = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// fixturesDir holds the terraform fixtures shared with the python tests.
+const fixturesDir = "../../../tests/terraform"
+
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+type goldenFixture struct {
+	// root is the terraform root module, relative to the fixture directory
+	root string
+	// opts are passed to NewTerraformConverter
+	opts []TerraformConverterOption
+	// volatile lists paths in the output whose value depends on the machine
+	// running the tests, and is replaced before comparison
+	volatile []string
+}
+
+// goldenFixtures describes fixtures that need more than the defaults. Every
+// other directory in fixturesDir is parsed as a root module with no options.
+var goldenFixtures = map[string]goldenFixture{
+	"attribute-references": {
+		opts: []TerraformConverterOption{WithAttributeReferences()},
+	},
+	"auto-tfvars": {
+		opts: []TerraformConverterOption{WithTFVarsPaths("explicit.tfvars")},
+	},
+	"conditional-branches": {
+		opts: []TerraformConverterOption{WithConditionalBranches()},
+	},
+	"data-source-stubs": {
+		opts: []TerraformConverterOption{WithDataSourceStubs("stubs.yaml")},
+	},
+	"file-data-sources": {
+		opts: []TerraformConverterOption{WithFileDataSources()},
+	},
+	"func-check": {
+		root:     "root",
+		volatile: []string{"locals.0.check_fileset_abs_path"},
+	},
+	"iam-policy-document": {
+		opts: []TerraformConverterOption{WithPolicyDocuments()},
+	},
+	"local-module-above-root": {
+		root: "root",
+	},
+	"plan-file": {
+		opts: []TerraformConverterOption{WithPlanFile("plan.json")},
+	},
+	"remote-state": {
+		opts: []TerraformConverterOption{
+			WithRemoteStateFiles(map[string]string{"s3:network/terraform.tfstate": "states/network.tfstate"}),
+			WithRemoteStateDir("states"),
+		},
+	},
+	"state-file": {
+		opts: []TerraformConverterOption{WithStateFile("terraform.tfstate")},
+	},
+	"typed-unknowns": {
+		opts: []TerraformConverterOption{WithTypedUnknowns()},
+	},
+	"variable-values": {
+		opts: []TerraformConverterOption{
+			WithEnvVariables([]string{
+				"TF_VAR_name=from-env",
+				`TF_VAR_zones=["us-east-1a", "us-east-1b"]`,
+				"TF_VAR_settings={enabled = true, retention = 30}",
+				"TF_VAR_undeclared=ignored",
+				"HOME=/root",
+			}),
+			WithTFVarsPaths("values.tfvars"),
+			WithVariables(map[string]string{
+				"instance_count": "2",
+				"tags":           `{Team = "platform"}`,
+				"untyped":        "[1, 2]",
+			}),
+		},
+	},
+}
+
+// TestVisitJSONGolden runs the converter over each of the terraform fixtures
+// and compares the output with the golden files in testdata/golden. Run with
+// -update to regenerate the golden files after an intended change in output.
+func TestVisitJSONGolden(t *testing.T) {
+	entries, err := os.ReadDir(fixturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		fixture := goldenFixtures[name]
+		t.Run(name, func(t *testing.T) {
+			got := convertFixture(t, filepath.Join(fixturesDir, name, fixture.root), fixture)
+			goldenPath := filepath.Join("testdata", "golden", name+".json")
+
+			if *updateGoldens {
+				if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%s (run with -update to create it)", err)
+			}
+
+			if diff := cmp.Diff(unmarshalGolden(t, want), unmarshalGolden(t, got)); diff != "" {
+				t.Errorf("output differs from %s (-want +got):\n%s", goldenPath, diff)
+			}
+		})
+	}
+}
+
+// convertFixture parses a fixture and returns its JSON output in the same
+// form as the golden files.
+func convertFixture(t *testing.T, path string, fixture goldenFixture) []byte {
+	t.Helper()
+
+	tfc, err := NewTerraformConverter(path, fixture.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := tfc.VisitJSON()
+	for _, p := range fixture.volatile {
+		if out.ExistsP(p) {
+			if _, err := out.SetP("<volatile>", p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return normalizeGolden(t, out)
+}
+
+// normalizeGolden indents the JSON output and replaces the randomly generated
+// block IDs with placeholders that are numbered by first appearance, so the
+// links between blocks are still checked.
+func normalizeGolden(t *testing.T, out *gabs.Container) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out.Data()); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]string{}
+	return uuidPattern.ReplaceAllFunc(buf.Bytes(), func(id []byte) []byte {
+		placeholder, ok := ids[string(id)]
+		if !ok {
+			placeholder = fmt.Sprintf("<id-%d>", len(ids)+1)
+			ids[string(id)] = placeholder
+		}
+		return []byte(placeholder)
+	})
+}
+
+func unmarshalGolden(t *testing.T, data []byte) any {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestNewTerraformConverterWithContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewTerraformConverterWithContext(ctx, filepath.Join(fixturesDir, "references"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestVisitJSONContextCancelled(t *testing.T) {
+	tfc, err := NewTerraformConverter(filepath.Join(fixturesDir, "references"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tfc.VisitJSONContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRunWithContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	_, err := runWithContext(ctx, func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	path := filepath.Join(fixturesDir, "diagnostics")
+	tfc, err := NewTerraformConverter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Diagnostic{
+		{
+			Severity: DiagnosticError,
+			Summary:  "Invalid expression",
+			Detail:   "Expected the start of an expression, but found an invalid expression token.",
+			Filename: "broken.tf",
+			Range:    &DiagnosticRange{LineStart: 2, ColumnStart: 11, LineEnd: 3, ColumnEnd: 1},
+		},
+		{
+			Severity: DiagnosticWarning,
+			Summary:  "Variable values were not found in the environment or variable files. Evaluating may not work correctly.",
+			Detail:   "variables: environment",
+		},
+		{
+			Severity: DiagnosticError,
+			Summary:  "Failed to load module. Maybe try 'terraform init'?",
+			Detail:   fmt.Sprintf("open %s: no such file or directory", filepath.Join(path, "modules", "missing")),
+			Path:     "module.missing",
+		},
+	}
+	if diff := cmp.Diff(want, tfc.Diagnostics()); diff != "" {
+		t.Errorf("unexpected diagnostics (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithStateFileMissing(t *testing.T) {
+	_, err := NewTerraformConverter(filepath.Join(fixturesDir, "state-file"), WithStateFile("missing.tfstate"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+
+	// the files that are given are read before the module is parsed, which
+	// would fail with the cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, opt := range []TerraformConverterOption{
+		WithStateFile("missing.tfstate"),
+		WithPlanFile("missing.json"),
+		WithDataSourceStubs("missing.yaml"),
+	} {
+		_, err := NewTerraformConverterWithContext(ctx, filepath.Join(fixturesDir, "state-file"), opt)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist, got %v", err)
+		}
+	}
+}
+
+// TestStateResourceIndexGaps checks that the instances of a resource using
+// count keep their index when there are gaps between them in state.
+func TestStateResourceIndexGaps(t *testing.T) {
+	r := stateResource{Instances: []stateInstance{
+		{IndexKey: float64(2), Attributes: json.RawMessage(`{"id": "c"}`)},
+		{IndexKey: float64(0), Attributes: json.RawMessage(`{"id": "a"}`)},
+	}}
+	val, err := r.value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := cty.TupleVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("a")}),
+		cty.DynamicVal,
+		cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("c")}),
+	})
+	if !val.RawEquals(want) {
+		t.Errorf("expected %#v, got %#v", want, val)
+	}
+}
+
+// TestWithDataSourceStubsJSON checks that stubs keyed by type and attribute
+// in a JSON file give the same output as the nested YAML stubs.
+func TestWithDataSourceStubsJSON(t *testing.T) {
+	path := filepath.Join(fixturesDir, "data-source-stubs")
+	want := convertFixture(t, path, goldenFixture{opts: []TerraformConverterOption{WithDataSourceStubs("stubs.yaml")}})
+	got := convertFixture(t, path, goldenFixture{opts: []TerraformConverterOption{WithDataSourceStubs("stubs.json")}})
+	if diff := cmp.Diff(unmarshalGolden(t, want), unmarshalGolden(t, got)); diff != "" {
+		t.Errorf("JSON stubs differ from YAML stubs (-yaml +json):\n%s", diff)
+	}
+}
+
+func TestWithDataSourceStubsInvalid(t *testing.T) {
+	path := filepath.Join(fixturesDir, "data-source-stubs")
+	for _, stubsFile := range []string{"missing.yaml", "main.tf"} {
+		if _, err := NewTerraformConverter(path, WithDataSourceStubs(stubsFile)); err == nil {
+			t.Errorf("expected an error reading %s", stubsFile)
+		}
+	}
+}
+
+func TestWithVariablesInvalid(t *testing.T) {
+	path := filepath.Join(fixturesDir, "variable-values")
+	for _, opt := range []TerraformConverterOption{
+		WithVariables(map[string]string{"zones": "[unclosed"}),
+		WithVariables(map[string]string{"undeclared": "value"}),
+		WithEnvVariables([]string{"TF_VAR_settings=var.other"}),
+	} {
+		if _, err := NewTerraformConverter(path, opt); err == nil {
+			t.Error("expected an error for an invalid variable value")
+		}
+	}
+}
+
+// TestWithEnvVariablesEmpty checks that an empty environment replaces the
+// process environment, even when every variable has a default.
+func TestWithEnvVariablesEmpty(t *testing.T) {
+	t.Setenv("TF_VAR_name", "from-process")
+	path := t.TempDir()
+	config := `
+variable "name" {
+  default = "from-default"
+}
+
+resource "aws_s3_bucket" "example" {
+  bucket = var.name
+}
+`
+	if err := os.WriteFile(filepath.Join(path, "main.tf"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tfc, err := NewTerraformConverter(path, WithEnvVariables([]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range tfc.modules {
+		for _, b := range m.GetBlocks() {
+			switch b.Type() {
+			case "variable":
+				val, source := tfc.getVariableValue(b)
+				if !val.RawEquals(cty.StringVal("from-default")) || source != variableSourceDefault {
+					t.Errorf("expected the default value, got %#v from %s", val, source)
+				}
+			case "resource":
+				if bucket := b.GetAttribute("bucket").Value(); !bucket.RawEquals(cty.StringVal("from-default")) {
+					t.Errorf("expected the default bucket name, got %#v", bucket)
+				}
+			}
+		}
+	}
+}
+
+// TestIndexKeys checks that references with index keys that aren't integers
+// are reported as they're written, rather than stopping the parse.
+func TestIndexKeys(t *testing.T) {
+	path := t.TempDir()
+	config := `
+variable "list" {
+  type = list(string)
+}
+
+locals {
+  fractional = var.list[1.5]
+  null_index = var.list[null]
+  upper      = upper(var.list[1.5])
+}
+`
+	if err := os.WriteFile(filepath.Join(path, "main.tf"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// function calls look up their references with the default options too
+	tfc, err := NewTerraformConverter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tfc.VisitJSON()
+
+	tfc, err = NewTerraformConverter(path, WithTypedUnknowns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := tfc.VisitJSON()
+	for name, want := range map[string]string{
+		"fractional": "var.list[1.5]",
+		"null_index": "var.list[null]",
+		"upper":      "var.list[1.5]",
+	} {
+		got := out.Search("locals", "0", name, "references").Data()
+		if diff := cmp.Diff([]string{want}, got); diff != "" {
+			t.Errorf("unexpected references of %s (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+// TestMergeUnknownMap checks that a merge with a map that isn't known is
+// marked as missing its keys.
+func TestMergeUnknownMap(t *testing.T) {
+	path := t.TempDir()
+	config := `
+variable "list" {
+  type = list(string)
+}
+
+resource "aws_instance" "web" {
+  tags = merge({ Name = "web" }, { for k in var.list : k => k })
+}
+`
+	if err := os.WriteFile(filepath.Join(path, "main.tf"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tfc, err := NewTerraformConverter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"Name": "web", "__unresolved__": "{ for k in var.list : k => k }"}
+	if diff := cmp.Diff(want, tfc.VisitJSON().Search("aws_instance", "0", "tags").Data()); diff != "" {
+		t.Errorf("unexpected tags (-want +got):\n%s", diff)
+	}
+
+	tfc, err = NewTerraformConverter(path, WithTypedUnknowns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tfc.VisitJSON().Search("aws_instance", "0", "tags", "__unknown__").Data()
+	if got != true {
+		t.Errorf("expected the tags to be unknown, got %#v", got)
+	}
+}
+
+func TestVariableFiles(t *testing.T) {
+	path := filepath.Join(fixturesDir, "auto-tfvars")
+	tests := []struct {
+		name string
+		opts []TerraformConverterOption
+		want []string
+	}{
+		{
+			name: "auto loaded",
+			opts: []TerraformConverterOption{WithTFVarsPaths("explicit.tfvars")},
+			want: []string{"terraform.tfvars", "terraform.tfvars.json", "a.auto.tfvars", "b.auto.tfvars.json", "explicit.tfvars"},
+		},
+		{
+			name: "disabled",
+			opts: []TerraformConverterOption{WithAutoLoadTFVars(false), WithTFVarsPaths("explicit.tfvars")},
+			want: []string{"explicit.tfvars"},
+		},
+		{
+			name: "none",
+			opts: []TerraformConverterOption{WithAutoLoadTFVars(false)},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfc, err := NewTerraformConverter(path, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, tfc.VariableFiles()); diff != "" {
+				t.Errorf("unexpected variable files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestModuleFunctions(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join(fixturesDir, "module-in-out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// file functions mustn't depend on the working directory
+	t.Chdir(t.TempDir())
+
+	tfc, err := NewTerraformConverter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, m := range tfc.modules {
+		for _, b := range m.GetBlocks() {
+			exists, err := tfc.getFunctions(b)["fileexists"].Call([]cty.Value{cty.StringVal("main.tf")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[tfc.getModuleAddress(b)] = exists.True()
+		}
+	}
+	want := map[string]bool{"": true, "module.bucket": true, "module.tags_base": true}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected results of fileexists (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnknownValue(t *testing.T) {
+	tests := []struct {
+		name string
+		val  cty.Value
+		want map[string]any
+	}{
+		{
+			name: "dynamic",
+			val:  cty.DynamicVal,
+			want: map[string]any{"__unknown__": true, "type": "any", "source": "var.x", "formatted": "var.x"},
+		},
+		{
+			name: "string prefix",
+			val:  cty.UnknownVal(cty.String).Refine().NotNull().StringPrefix("arn:").NewValue(),
+			want: map[string]any{
+				"__unknown__": true,
+				"type":        "string",
+				"source":      "var.x",
+				"formatted":   "var.x",
+				"refinements": map[string]any{"not_null": true, "prefix": "arn:"},
+			},
+		},
+		{
+			name: "length bounds",
+			val:  cty.UnknownVal(cty.List(cty.String)).Refine().CollectionLengthLowerBound(1).CollectionLengthUpperBound(3).NewValue(),
+			want: map[string]any{
+				"__unknown__": true,
+				"type":        "list(string)",
+				"source":      "var.x",
+				"formatted":   "var.x",
+				"refinements": map[string]any{"length_min": 1, "length_max": 3},
+			},
+		},
+		{
+			name: "sensitive",
+			val:  cty.UnknownVal(cty.Map(cty.String)).Mark("sensitive"),
+			want: map[string]any{"__unknown__": true, "type": "map(string)", "source": "var.x", "formatted": "var.x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, unknownValue(tt.val, "var.x", nil)); diff != "" {
+				t.Errorf("unexpected unknown value (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnresolvedPlaceholders(t *testing.T) {
+	u := &unresolvedValues{nonce: "123456789012"}
+	placeholder := u.placeholder(unresolvedValue{source: "var.a", value: cty.UnknownVal(cty.String)})
+	// text from the configuration that only looks like a placeholder
+	lookalike := placeholderStart + "000000000000" + "0" + placeholderEnd
+	str := "\U000F0005-" + lookalike + "-" + placeholder
+
+	if got, want := u.native(cty.StringVal(str), "x"), "\U000F0005-"+lookalike+"-${var.a}"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := u.native(cty.StringVal(lookalike), "x"); got != lookalike {
+		t.Errorf("expected %q to be kept, got %#v", lookalike, got)
+	}
+}
+
+// TestUnresolvedListPlaceholder checks that the placeholder of a whole list
+// is a single marker, rather than a list of one element.
+func TestUnresolvedListPlaceholder(t *testing.T) {
+	u := &unresolvedValues{}
+	list := u.placeholderValue(unresolvedValue{source: "var.list", value: cty.UnknownVal(cty.List(cty.String))}, cty.List(cty.String))
+	encoded, err := stdlib.JSONEncodeFunc.Call([]cty.Value{cty.ObjectVal(map[string]cty.Value{"a": list})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(map[string]any{"__unresolved__": "var.list"}, u.native(list, "x")); diff != "" {
+		t.Errorf("unexpected list (-want +got):\n%s", diff)
+	}
+	if got, want := u.native(encoded, "x"), `{"a":{"__unresolved__":"var.list"}}`; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestFormatExpression(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		ok     bool
+	}{
+		{source: `var.env=="prod"?3:1`, want: `var.env == "prod" ? 3 : 1`, ok: true},
+		{source: `join(",",var.subnet_ids)`, want: `join(",", var.subnet_ids)`, ok: true},
+		{source: "{\n      a=1\n  bb = 2\n}", want: "{\n  a  = 1\n  bb = 2\n}", ok: true},
+		{source: "main.tf:3,5-10", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, ok := formatExpression(tt.source)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("formatExpression(%q) = %q, %v, want %q, %v", tt.source, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWithPlanFileInvalid(t *testing.T) {
+	path := filepath.Join(fixturesDir, "plan-file")
+	for _, planFile := range []string{"missing.json", "main.tf", filepath.Join("..", "state-file", "terraform.tfstate")} {
+		if _, err := NewTerraformConverter(path, WithPlanFile(planFile)); err == nil {
+			t.Errorf("expected an error reading %s", planFile)
+		}
+	}
+}
+
+func TestWithLoggerIsPerConverter(t *testing.T) {
+	var debugOut, infoOut bytes.Buffer
+	debugLogger := slog.New(slog.NewTextHandler(&debugOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	infoLogger := slog.New(slog.NewTextHandler(&infoOut, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	path := filepath.Join(fixturesDir, "func-check", "root")
+	var wg sync.WaitGroup
+	for _, opts := range [][]TerraformConverterOption{
+		{WithDebug(), WithLogger(debugLogger)},
+		{WithLogger(infoLogger)},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tfc, err := NewTerraformConverter(path, opts...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tfc.VisitJSON()
+		}()
+	}
+	wg.Wait()
+
+	if !strings.Contains(debugOut.String(), "level=DEBUG") {
+		t.Errorf("expected debug logs from the debug converter, got:\n%s", debugOut.String())
+	}
+	if strings.Contains(infoOut.String(), "level=DEBUG") {
+		t.Errorf("expected no debug logs from the other converter, got:\n%s", infoOut.String())
+	}
+	if defaultLogger.Load().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected WithDebug to leave the default logger alone")
+	}
+}
+
+// TestVisitNDJSON checks that merging the lines of NDJSON output for each
+// fixture gives the same output as VisitJSON.
+func TestVisitNDJSON(t *testing.T) {
+	for _, name := range []string{"references", "module-references", "block-types", "dynamic-stuff"} {
+		t.Run(name, func(t *testing.T) {
+			tfc, err := NewTerraformConverter(filepath.Join(fixturesDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := unmarshalGolden(t, tfc.VisitJSON().Bytes())
+
+			var buf bytes.Buffer
+			if err := tfc.VisitNDJSON(context.Background(), &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			merged := gabs.New()
+			for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+				var block map[string]any
+				if err := json.Unmarshal(line, &block); err != nil {
+					t.Fatalf("invalid line %q: %s", line, err)
+				}
+				if len(block) != 1 {
+					t.Fatalf("expected a single key in line %q", line)
+				}
+				for key, obj := range block {
+					if err := merged.ArrayAppendP(obj, key); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if diff := cmp.Diff(want, unmarshalGolden(t, merged.Bytes())); diff != "" {
+				t.Errorf("NDJSON output differs from VisitJSON (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+const (
+	DiagnosticError   = "error"
+	DiagnosticWarning = "warning"
+)
+
+// Diagnostic describes a problem found while parsing or evaluating a module,
+// which may mean that the JSON output is incomplete.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	// Range is the location in Filename that the diagnostic applies to, if known.
+	Range *DiagnosticRange `json:"range,omitempty"`
+	// Path is the path of the block that the diagnostic originated from, such
+	// as "module.vpc". It's empty for diagnostics from the root module.
+	Path string `json:"path,omitempty"`
+}
+
+type DiagnosticRange struct {
+	LineStart   int `json:"line_start"`
+	ColumnStart int `json:"column_start"`
+	LineEnd     int `json:"line_end"`
+	ColumnEnd   int `json:"column_end"`
+}
+
+// diagnostics collects diagnostics from the parser, which may log from more
+// than one goroutine.
+type diagnostics struct {
+	mu    sync.Mutex
+	diags []Diagnostic
+	// moduleDirs are the directories of the modules that diagnostics without
+	// a path are about, by the index of the diagnostic
+	moduleDirs map[int]string
+}
+
+func (d *diagnostics) add(diag Diagnostic, moduleDir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if diag.Path == "" && moduleDir != "" {
+		if d.moduleDirs == nil {
+			d.moduleDirs = make(map[int]string)
+		}
+		d.moduleDirs[len(d.diags)] = filepath.Clean(moduleDir)
+	}
+	d.diags = append(d.diags, diag)
+}
+
+// setModulePaths sets the path of the diagnostics about modules that failed
+// to load, which the parser only logs with the directory of the module, from
+// the addresses of module blocks by the directory of their source.
+func (d *diagnostics) setModulePaths(addresses map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, dir := range d.moduleDirs {
+		if address, ok := addresses[dir]; ok {
+			d.diags[i].Path = address
+		}
+	}
+}
+
+func (d *diagnostics) list() []Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnostic{}, d.diags...)
+}
+
+// diagnosticsHandler is a slog.Handler for the parser's logger, which turns
+// warnings and errors in to diagnostics before passing records on to the next
+// handler.
+//
+// The parser doesn't return the problems that it works around, it only logs
+// them, so its log records are the only place to find them.
+type diagnosticsHandler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+	diags *diagnostics
+}
+
+func newDiagnosticsHandler(next slog.Handler, diags *diagnostics) *diagnosticsHandler {
+	return &diagnosticsHandler{next: next, diags: diags}
+}
+
+func (h *diagnosticsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *diagnosticsHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		h.diags.add(h.newDiagnostic(r))
+	}
+	if h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *diagnosticsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &diagnosticsHandler{
+		next:  h.next.WithAttrs(attrs),
+		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+		diags: h.diags,
+	}
+}
+
+func (h *diagnosticsHandler) WithGroup(name string) slog.Handler {
+	return &diagnosticsHandler{
+		next:  h.next.WithGroup(name),
+		attrs: h.attrs,
+		diags: h.diags,
+	}
+}
+
+// newDiagnostic builds a diagnostic from a log record. HCL diagnostics carry
+// their own summary and source range, anything else is described by the log
+// message and its attributes. It also returns the directory of the module
+// that the record is about, if it's an error opening a module.
+func (h *diagnosticsHandler) newDiagnostic(r slog.Record) (Diagnostic, string) {
+	diag := Diagnostic{
+		Severity: DiagnosticWarning,
+		Summary:  r.Message,
+	}
+	if r.Level >= slog.LevelError {
+		diag.Severity = DiagnosticError
+	}
+
+	var details []string
+	var moduleDir string
+	handleAttr := func(a slog.Attr) bool {
+		switch a.Key {
+		case "prefix", "cause":
+			// the log prefix is the same for every parser record, and the
+			// cause of a parse error is the source at its range
+		case "module":
+			if name := a.Value.String(); name != "root" {
+				diag.Path = "module." + name
+			}
+		case "name":
+			// submodules that fail to load are logged by their parent
+			diag.Path = "module." + a.Value.String()
+		case "file_path":
+			diag.Filename = a.Value.String()
+		case "err":
+			err, _ := a.Value.Any().(error)
+			var hclDiag *hcl.Diagnostic
+			if errors.As(err, &hclDiag) {
+				diag.Summary = hclDiag.Summary
+				details = append(details, hclDiag.Detail)
+				if subj := hclDiag.Subject; subj != nil {
+					diag.Filename = subj.Filename
+					diag.Range = &DiagnosticRange{
+						LineStart:   subj.Start.Line,
+						ColumnStart: subj.Start.Column,
+						LineEnd:     subj.End.Line,
+						ColumnEnd:   subj.End.Column,
+					}
+				}
+			} else if err != nil {
+				details = append(details, err.Error())
+			}
+			// modules that fail to load are only logged with their directory
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				moduleDir = pathErr.Path
+			}
+		default:
+			details = append(details, fmt.Sprintf("%s: %s", a.Key, a.Value))
+		}
+		return true
+	}
+
+	for _, a := range h.attrs {
+		handleAttr(a)
+	}
+	r.Attrs(handleAttr)
+
+	diag.Detail = strings.Join(details, "\n")
+	return diag, moduleDir
+}
+
+var _ slog.Handler = (*diagnosticsHandler)(nil)
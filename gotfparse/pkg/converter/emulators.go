@@ -0,0 +1,120 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"errors"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// valueSourceEmulated marks attribute values that were worked out from data
+// sources that were evaluated locally.
+const valueSourceEmulated = "emulated"
+
+// dataSourceEmulator works out the attributes of a data source from its
+// configuration, evaluated with the given variables.
+type dataSourceEmulator func(t *terraformConverter, b *terraform.Block, vars map[string]cty.Value) (map[string]cty.Value, error)
+
+// errUnknownValue is returned when a data source can't be emulated because
+// its configuration isn't wholly known.
+var errUnknownValue = errors.New("value is not known")
+
+func (t *terraformConverter) getDataSourceEmulator(b *terraform.Block) dataSourceEmulator {
+	if b.Type() != "data" {
+		return nil
+	}
+	if b.TypeLabel() == "aws_iam_policy_document" && t.policyDocuments {
+		return (*terraformConverter).emulatePolicyDocument
+	}
+	if t.fileDataSources {
+		if emulate, ok := fileDataSourceEmulators[b.TypeLabel()]; ok {
+			return emulate
+		}
+	}
+	if b.TypeLabel() == "terraform_remote_state" && (len(t.remoteStateFiles) > 0 || t.remoteStateDir != "") {
+		return (*terraformConverter).emulateRemoteState
+	}
+	return nil
+}
+
+func (t *terraformConverter) hasEmulatedDataSources(blocks terraform.Blocks) bool {
+	for _, b := range blocks {
+		if t.getDataSourceEmulator(b) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// emulateDataSources evaluates the data sources of a module that can be
+// evaluated locally with the given overrides, and replaces their values in the
+// "data" override. It reports whether any of the values changed.
+func (t *terraformConverter) emulateDataSources(blocks terraform.Blocks, moduleCtx *hcl.EvalContext, overrides map[string]cty.Value) bool {
+	data, ok := overrides["data"]
+	if !ok {
+		data = lookupVariable(moduleCtx, "data")
+	}
+
+	changed := false
+	for _, b := range blocks {
+		emulate := t.getDataSourceEmulator(b)
+		if emulate == nil {
+			continue
+		}
+
+		attrs, err := emulate(t, b, overrides)
+		if err != nil {
+			t.logger.Debug("unable to emulate data source", "block", b.FullName(), "error", err)
+			continue
+		}
+		t.emulated[b.ID()] = attrs
+
+		updated := setDataSourceValue(data, b, replaceAttributes(b.Values(), cty.ObjectVal(attrs)))
+		if !updated.RawEquals(data) {
+			data = updated
+			changed = true
+		}
+	}
+
+	if changed {
+		overrides["data"] = data
+	}
+	return changed
+}
+
+// getEmulatedValues returns the attributes of a data source that were worked
+// out by emulating it, if it was emulated.
+func (t *terraformConverter) getEmulatedValues(b *terraform.Block) map[string]cty.Value {
+	if t.getDataSourceEmulator(b) == nil {
+		return nil
+	}
+	// the data sources of a module are emulated with its overrides
+	t.getModuleOverrides(b)
+	return t.emulated[b.ID()]
+}
+
+// evaluateWith evaluates an attribute of a block with the given variables. It
+// returns cty.NilVal if the block doesn't have the attribute, and
+// errUnknownValue if the value isn't wholly known.
+func (t *terraformConverter) evaluateWith(b *terraform.Block, name string, vars map[string]cty.Value) (cty.Value, error) {
+	a := b.GetAttribute(name)
+	if a == nil {
+		return cty.NilVal, nil
+	}
+
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	val, diags := hclAttr.Expr.Value(newOverrideContext(b.Context().Inner(), vars))
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	if !val.IsWhollyKnown() {
+		return cty.NilVal, errUnknownValue
+	}
+	return val, nil
+}
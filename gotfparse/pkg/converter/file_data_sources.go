@@ -0,0 +1,308 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser/funcs"
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// fileDataSourceEmulators are the data sources that only read the local
+// filesystem. They're only emulated with WithFileDataSources.
+var fileDataSourceEmulators = map[string]dataSourceEmulator{
+	"archive_file":         (*terraformConverter).emulateArchiveFile,
+	"local_file":           (*terraformConverter).emulateLocalFile,
+	"local_sensitive_file": (*terraformConverter).emulateLocalFile,
+}
+
+// emulateLocalFile reads the file of a local_file or local_sensitive_file data
+// source, like the local provider.
+func (t *terraformConverter) emulateLocalFile(b *terraform.Block, vars map[string]cty.Value) (map[string]cty.Value, error) {
+	filename, err := t.evaluateString(b, "filename", vars)
+	if err != nil {
+		return nil, err
+	}
+	if filename == "" {
+		return nil, errors.New("filename is required")
+	}
+
+	content, err := t.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]cty.Value{
+		"content":        cty.StringVal(string(content)),
+		"content_base64": cty.StringVal(base64.StdEncoding.EncodeToString(content)),
+	}
+	if b.TypeLabel() == "local_sensitive_file" {
+		for name, val := range attrs {
+			attrs[name] = val.Mark(funcs.MarkedSensitive)
+		}
+	}
+
+	hashes := fileHashes(content)
+	for name, val := range hashes {
+		attrs["content_"+name] = val
+	}
+	attrs["id"] = hashes["sha1"]
+	return attrs, nil
+}
+
+// emulateArchiveFile builds the zip archive of an archive_file data source in
+// memory, like the archive provider, and returns its size and hashes. The
+// archive isn't written to output_path.
+func (t *terraformConverter) emulateArchiveFile(b *terraform.Block, vars map[string]cty.Value) (map[string]cty.Value, error) {
+	archiveType, err := t.evaluateString(b, "type", vars)
+	if err != nil {
+		return nil, err
+	}
+	if archiveType != "zip" {
+		return nil, fmt.Errorf("unsupported archive type %q", archiveType)
+	}
+
+	var fileMode *fs.FileMode
+	if mode, err := t.evaluateString(b, "output_file_mode", vars); err != nil {
+		return nil, err
+	} else if mode != "" {
+		m, err := strconv.ParseUint(mode, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output_file_mode %q: %w", mode, err)
+		}
+		fm := fs.FileMode(m)
+		fileMode = &fm
+	}
+
+	var buf bytes.Buffer
+	w := &zipArchive{writer: zip.NewWriter(&buf), fileMode: fileMode}
+	if err := t.addArchiveSources(w, b, vars); err != nil {
+		return nil, err
+	}
+	if err := w.writer.Close(); err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]cty.Value{
+		"output_size": cty.NumberIntVal(int64(buf.Len())),
+	}
+	hashes := fileHashes(buf.Bytes())
+	for name, val := range hashes {
+		if name == "sha1" {
+			name = "sha"
+		}
+		attrs["output_"+name] = val
+	}
+	attrs["id"] = hashes["sha1"]
+	return attrs, nil
+}
+
+func (t *terraformConverter) addArchiveSources(w *zipArchive, b *terraform.Block, vars map[string]cty.Value) error {
+	if content, err := t.evaluateWith(b, "source_content", vars); err != nil {
+		return err
+	} else if content != cty.NilVal {
+		filename, err := t.evaluateString(b, "source_content_filename", vars)
+		if err != nil {
+			return err
+		}
+		if filename == "" {
+			return errors.New("source_content_filename is required with source_content")
+		}
+		content, _ = content.UnmarkDeep()
+		return w.add(filename, nil, []byte(content.AsString()))
+	}
+
+	if filename, err := t.evaluateString(b, "source_file", vars); err != nil {
+		return err
+	} else if filename != "" {
+		info, err := fs.Stat(t.fileSystem, t.fsName(filename))
+		if err != nil {
+			return err
+		}
+		content, err := t.readFile(filename)
+		if err != nil {
+			return err
+		}
+		return w.add(info.Name(), info, content)
+	}
+
+	if dir, err := t.evaluateString(b, "source_dir", vars); err != nil {
+		return err
+	} else if dir != "" {
+		excludes, err := t.evaluateStrings(b, "excludes", vars)
+		if err != nil {
+			return err
+		}
+		return t.addArchiveDir(w, dir, excludes)
+	}
+
+	// source blocks are added in order of filename, so the hashes are stable
+	contents := map[string][]byte{}
+	for _, sb := range b.GetBlocks("source") {
+		filename, err := t.evaluateString(sb, "filename", vars)
+		if err != nil {
+			return err
+		}
+		content, err := t.evaluateString(sb, "content", vars)
+		if err != nil {
+			return err
+		}
+		contents[filename] = []byte(content)
+	}
+	if len(contents) == 0 {
+		return errors.New("one of source, source_content, source_file or source_dir is required")
+	}
+	for _, filename := range slices.Sorted(maps.Keys(contents)) {
+		if err := w.add(filename, nil, contents[filename]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addArchiveDir adds the files within a directory, except those matching any
+// of the exclude patterns, to an archive.
+func (t *terraformConverter) addArchiveDir(w *zipArchive, dir string, excludes []string) error {
+	root := t.fsName(dir)
+	empty := true
+	err := fs.WalkDir(t.fileSystem, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		excluded := false
+		for _, exclude := range excludes {
+			if exclude == "" {
+				continue
+			}
+			match, err := path.Match(filepath.ToSlash(exclude), rel)
+			if err != nil {
+				return err
+			}
+			excluded = excluded || match
+		}
+
+		if d.IsDir() {
+			if excluded && rel != "." {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if excluded {
+			return nil
+		}
+
+		info, err := fs.Stat(t.fileSystem, name)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// symbolic links to directories aren't followed
+			return nil
+		}
+		content, err := fs.ReadFile(t.fileSystem, name)
+		if err != nil {
+			return err
+		}
+		empty = false
+		return w.add(rel, info, content)
+	})
+	if err != nil {
+		return err
+	}
+	if empty {
+		return errors.New("archive would be empty")
+	}
+	return nil
+}
+
+// zipArchive writes the entries of a zip archive the same way as the archive
+// provider, so that the archive has the same hashes.
+type zipArchive struct {
+	writer   *zip.Writer
+	fileMode *fs.FileMode
+}
+
+func (a *zipArchive) add(name string, info fs.FileInfo, content []byte) error {
+	fh := &zip.FileHeader{}
+	if info != nil {
+		var err error
+		if fh, err = zip.FileInfoHeader(info); err != nil {
+			return err
+		}
+	}
+	fh.Name = filepath.ToSlash(name)
+	fh.Method = zip.Deflate
+	// the modification time is left out, so that the hashes are stable
+	fh.SetModTime(time.Time{})
+	if a.fileMode != nil {
+		fh.SetMode(*a.fileMode)
+	}
+
+	f, err := a.writer.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+// fileHashes returns the hashes of a file's content that the local and
+// archive providers expose, by the suffix of their attribute names.
+func fileHashes(content []byte) map[string]cty.Value {
+	md5Sum := md5.Sum(content)
+	sha1Sum := sha1.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	return map[string]cty.Value{
+		"md5":          cty.StringVal(hex.EncodeToString(md5Sum[:])),
+		"sha1":         cty.StringVal(hex.EncodeToString(sha1Sum[:])),
+		"sha256":       cty.StringVal(hex.EncodeToString(sha256Sum[:])),
+		"base64sha256": cty.StringVal(base64.StdEncoding.EncodeToString(sha256Sum[:])),
+		"sha512":       cty.StringVal(hex.EncodeToString(sha512Sum[:])),
+		"base64sha512": cty.StringVal(base64.StdEncoding.EncodeToString(sha512Sum[:])),
+	}
+}
+
+// readFile reads a file through the converter's file system, which resolves
+// paths relative to the root module, like Terraform does.
+func (t *terraformConverter) readFile(filename string) ([]byte, error) {
+	return fs.ReadFile(t.fileSystem, t.fsName(filename))
+}
+
+// fsName returns the name of a file in the converter's file system, which is
+// relative to the root module.
+func (t *terraformConverter) fsName(filename string) string {
+	root, err := filepath.Abs(t.filePath)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(filename))
+	}
+	rel, err := filepath.Rel(root, resolvePath(root, filename))
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(filename))
+	}
+	return filepath.ToSlash(rel)
+}
@@ -2,7 +2,12 @@
 // SPDX-License-Identifier: Apache-2.0
 package converter
 
-import "github.com/Jeffail/gabs/v2"
+import (
+	"context"
+	"io"
+
+	"github.com/Jeffail/gabs/v2"
+)
 
 // TerraformConverter uses defsec to parse HCL blocks in to memory and output them as JSON.
 // Further post-processing can be done on the HCL blocks in memory by calling the public methods of
@@ -10,3 +15,9 @@ import "github.com/Jeffail/gabs/v2"
 type TerraformConverter interface {
 	VisitJSON() *gabs.Container
 }
+
+// ContextVisitor visits the blocks of a TerraformConverter until a context is done.
+type ContextVisitor interface {
+	VisitJSONContext(ctx context.Context) (*gabs.Container, error)
+	VisitNDJSON(ctx context.Context, w io.Writer) error
+}
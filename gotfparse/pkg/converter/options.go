@@ -2,11 +2,27 @@
 // SPDX-License-Identifier: Apache-2.0
 package converter
 
+import "log/slog"
+
 type TerraformConverterOptions interface {
 	SetDebug()
+	SetLogger(logger *slog.Logger)
+	SetAttributeReferences()
+	SetTypedUnknowns()
+	SetConditionalBranches()
+	SetPolicyDocuments()
+	SetFileDataSources()
+	SetRemoteStateFiles(files map[string]string)
+	SetRemoteStateDir(dir string)
+	SetDataSourceStubs(path string)
+	SetStateFile(path string)
+	SetPlanFile(path string)
 	SetStopOnHCLError()
 	SetAllowDownloads(allowed bool)
 	SetTFVarsPaths(paths ...string)
+	SetVariables(vars map[string]string)
+	SetEnvVariables(environ []string)
+	SetAutoLoadTFVars(enabled bool)
 	SetWorkspaceName(workspace string)
 }
 
@@ -19,6 +35,96 @@ func WithDebug() TerraformConverterOption {
 	}
 }
 
+// WithLogger sets the logger for a single converter, without affecting any others in the process.
+// Combine it with WithDebug to include the debug logs of the underlying defsec parser.
+func WithLogger(logger *slog.Logger) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetLogger(logger)
+	}
+}
+
+// WithAttributeReferences includes the IDs of the blocks referenced by each attribute in block metadata, keyed by
+// attribute path such as "ingress[0].security_groups", so that it's clear which attribute references which block.
+func WithAttributeReferences() TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetAttributeReferences()
+	}
+}
+
+// WithTypedUnknowns represents every value that isn't known as an object such as
+// {"__unknown__": true, "type": "string", "source": "aws_s3_bucket.logs.arn"}, with what's known of the value.
+func WithTypedUnknowns() TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetTypedUnknowns()
+	}
+}
+
+// WithConditionalBranches represents a conditional with an unknown condition by the values of both its branches,
+// such as {"__one_of__": ["aws:kms", "AES256"], "condition": "var.enabled"}.
+func WithConditionalBranches() TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetConditionalBranches()
+	}
+}
+
+// WithPolicyDocuments evaluates aws_iam_policy_document data sources, so that their json attributes resolve.
+func WithPolicyDocuments() TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetPolicyDocuments()
+	}
+}
+
+// WithFileDataSources evaluates the archive_file, local_file and local_sensitive_file data sources by reading the
+// files they refer to, without writing any archives.
+func WithFileDataSources() TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetFileDataSources()
+	}
+}
+
+// WithRemoteStateFiles reads the outputs of terraform_remote_state data sources from local state files, keyed by
+// backend and state key such as "s3:network/terraform.tfstate".
+func WithRemoteStateFiles(files map[string]string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetRemoteStateFiles(files)
+	}
+}
+
+// WithRemoteStateDir reads the outputs of terraform_remote_state data sources from a directory of state files
+// named by workspace.
+func WithRemoteStateDir(dir string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetRemoteStateDir(dir)
+	}
+}
+
+// WithDataSourceStubs replaces the attributes of data sources with stand-in values from a YAML or JSON file, which
+// maps data source types to attributes and their values.
+func WithDataSourceStubs(path string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetDataSourceStubs(path)
+	}
+}
+
+// WithStateFile fills in values that aren't known until apply time from a terraform.tfstate file. A relative path
+// is relative to the module directory. Attributes that use values from state are listed in the "value_sources"
+// entry of block metadata.
+func WithStateFile(path string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetStateFile(path)
+	}
+}
+
+// WithPlanFile fills in values that aren't known from configuration from a plan, as output by
+// `terraform show -json`. Resources are matched by address, the planned values are preferred to the prior state,
+// and attributes that the plan says won't be known until apply are listed in the "after_unknown" entry of block
+// metadata. A relative path is relative to the module directory. It takes precedence over WithStateFile.
+func WithPlanFile(path string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetPlanFile(path)
+	}
+}
+
 // WithStopOnHCLError sets the underlying defsec parser to error and stop on HCL parsing errors.
 func WithStopOnHCLError() TerraformConverterOption {
 	return func(t TerraformConverterOptions) {
@@ -40,6 +146,29 @@ func WithTFVarsPaths(paths ...string) TerraformConverterOption {
 	}
 }
 
+// WithVariables sets the values of root module variables, like the -var option of terraform plan.
+func WithVariables(vars map[string]string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetVariables(vars)
+	}
+}
+
+// WithEnvVariables reads TF_VAR_ variables from an environment in the form of os.Environ, rather than from the
+// process environment.
+func WithEnvVariables(environ []string) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetEnvVariables(environ)
+	}
+}
+
+// WithAutoLoadTFVars sets whether the terraform.tfvars and *.auto.tfvars files of the root module are loaded, like
+// Terraform does. It's enabled by default.
+func WithAutoLoadTFVars(enabled bool) TerraformConverterOption {
+	return func(t TerraformConverterOptions) {
+		t.SetAutoLoadTFVars(enabled)
+	}
+}
+
 // WithWorkspaceName sets the Terraform workspace name.
 func WithWorkspaceName(workspace string) TerraformConverterOption {
 	return func(t TerraformConverterOptions) {
@@ -0,0 +1,339 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// overrideLayer is a set of variables that a module's attributes are
+// re-evaluated with, in place of values that weren't known when the module
+// was evaluated. Each layer of a module builds on the one before it.
+type overrideLayer struct {
+	// source is the value source of the attributes whose values change
+	source string
+	vars   map[string]cty.Value
+	// fillOnly only accepts values that are more known than the value from
+	// configuration, rather than any value that differs from it
+	fillOnly bool
+}
+
+// getModuleOverrides returns the override layers for the module that a block
+// belongs to. The layers are worked out once for each module.
+func (t *terraformConverter) getModuleOverrides(b *terraform.Block) []overrideLayer {
+	module := t.getModuleAddress(b)
+	if layers, ok := t.overrides[module]; ok {
+		return layers
+	}
+
+	layers, err := t.buildModuleOverrides(module)
+	if err != nil {
+		t.logger.Error("unable to work out override values", "module", module, "error", err)
+	}
+	t.overrides[module] = layers
+	return layers
+}
+
+func (t *terraformConverter) buildModuleOverrides(module string) ([]overrideLayer, error) {
+	var blocks terraform.Blocks
+	for _, m := range t.modules {
+		for _, b := range m.GetBlocks() {
+			if t.getModuleAddress(b) == module {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	moduleCtx := blocks[0].Context().Inner()
+
+	var layers []overrideLayer
+	vars := map[string]cty.Value{}
+
+	if data, ok := t.stubDataSources(blocks, lookupVariable(moduleCtx, "data")); ok {
+		vars = map[string]cty.Value{"data": data}
+		if err := t.evaluateDerivedValues(blocks, moduleCtx, vars, replaceAttributes, false); err != nil {
+			return layers, err
+		}
+		layers = append(layers, overrideLayer{source: valueSourceStub, vars: vars})
+	}
+
+	if t.hasEmulatedDataSources(blocks) {
+		vars = maps.Clone(vars)
+		if err := t.evaluateDerivedValues(blocks, moduleCtx, vars, replaceAttributes, true); err != nil {
+			return layers, err
+		}
+		layers = append(layers, overrideLayer{source: valueSourceEmulated, vars: vars})
+	}
+
+	if t.state != nil {
+		stateVars, err := t.state.variables(module)
+		if err != nil || len(stateVars) == 0 {
+			return layers, err
+		}
+
+		vars = maps.Clone(vars)
+		for name, val := range stateVars {
+			current, ok := vars[name]
+			if !ok {
+				current = lookupVariable(moduleCtx, name)
+			}
+			vars[name] = fillUnknowns(current, val)
+		}
+		if err := t.evaluateDerivedValues(blocks, moduleCtx, vars, fillUnknowns, true); err != nil {
+			return layers, err
+		}
+		layers = append(layers, overrideLayer{source: valueSourceState, vars: vars, fillOnly: true})
+	}
+
+	return layers, nil
+}
+
+// evaluateDerivedValues re-evaluates the local values of a module, and the
+// defaults of its input variables, with the given overrides, and merges the
+// results into the overrides. When emulate is set, data sources that can be
+// worked out locally are evaluated too. Each pass resolves another level of
+// values that refer to other values.
+func (t *terraformConverter) evaluateDerivedValues(blocks terraform.Blocks, moduleCtx *hcl.EvalContext, overrides map[string]cty.Value, merge func(previous, current cty.Value) cty.Value, emulate bool) error {
+	for range 10 {
+		changed := false
+		if emulate {
+			changed = t.emulateDataSources(blocks, moduleCtx, overrides)
+		}
+
+		values := map[string]map[string]cty.Value{"local": {}, "var": {}}
+		for _, b := range blocks {
+			ctx := newOverrideContext(b.Context().Inner(), overrides)
+			switch b.Type() {
+			case "locals":
+				for _, a := range b.GetAttributes() {
+					hclAttr, err := t.adapter.HCLAttribute(a)
+					if err != nil {
+						return err
+					}
+					if val, diags := hclAttr.Expr.Value(ctx); !diags.HasErrors() {
+						values["local"][a.Name()] = val
+					}
+				}
+			case "variable":
+				if val, ok, err := t.evaluateVariableDefault(b, moduleCtx, ctx); err != nil {
+					return err
+				} else if ok {
+					values["var"][b.Label()] = val
+				}
+			}
+		}
+
+		for name, byName := range values {
+			if len(byName) == 0 {
+				continue
+			}
+			previous, ok := overrides[name]
+			if !ok {
+				previous = lookupVariable(moduleCtx, name)
+			}
+			current := merge(previous, cty.ObjectVal(byName))
+			if !previous.RawEquals(current) {
+				overrides[name] = current
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return nil
+}
+
+// evaluateVariableDefault re-evaluates the default of an input variable in
+// ctx, as long as the variable's value came from its default.
+func (t *terraformConverter) evaluateVariableDefault(b *terraform.Block, moduleCtx *hcl.EvalContext, ctx *hcl.EvalContext) (cty.Value, bool, error) {
+	a := b.GetAttribute("default")
+	if a == nil {
+		return cty.NilVal, false, nil
+	}
+
+	vars := lookupVariable(moduleCtx, "var")
+	if vars == cty.NilVal || !vars.Type().IsObjectType() || !vars.Type().HasAttribute(b.Label()) {
+		return cty.NilVal, false, nil
+	}
+	if current := vars.GetAttr(b.Label()); !current.RawEquals(convertVariableValue(b, a.Value())) {
+		// the value was set by a variable file or the environment
+		return cty.NilVal, false, nil
+	}
+
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		return cty.NilVal, false, err
+	}
+	val, diags := hclAttr.Expr.Value(ctx)
+	if diags.HasErrors() {
+		return cty.NilVal, false, nil
+	}
+	return convertVariableValue(b, val), true, nil
+}
+
+// convertVariableValue converts a value to the type of an input variable, if
+// it has one that the value can be converted to.
+func convertVariableValue(b *terraform.Block, val cty.Value) cty.Value {
+	typeAttr := b.GetAttribute("type")
+	if typeAttr == nil {
+		return val
+	}
+	ty, _, err := typeAttr.DecodeVarType()
+	if err != nil {
+		return val
+	}
+	if converted, err := convert.Convert(val, ty); err == nil {
+		return converted
+	}
+	return val
+}
+
+// getOverriddenValue re-evaluates an attribute with each of the override
+// layers of its module, and returns the result along with where it came from,
+// if it's better than the value from configuration.
+func (t *terraformConverter) getOverriddenValue(b *terraform.Block, a *terraform.Attribute) (cty.Value, string, bool) {
+	if b.Context() == nil {
+		return cty.NilVal, "", false
+	}
+
+	layers := t.getModuleOverrides(b)
+	if len(layers) == 0 {
+		return cty.NilVal, "", false
+	}
+
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		t.logger.Error("unable to get hcl attribute", "name", a.Name(), "error", err)
+		return cty.NilVal, "", false
+	}
+	ctx := b.Context().Inner()
+
+	val, source, found := a.Value(), "", false
+	for _, layer := range layers {
+		if layer.fillOnly && val.IsWhollyKnown() {
+			continue
+		}
+		// stubbed and emulated data sources replace placeholder values,
+		// which look like they're known
+		if !layer.fillOnly && !referencesRoots(hclAttr.Expr, "data", "local", "var") {
+			continue
+		}
+
+		evaluated, diags := hclAttr.Expr.Value(newOverrideContext(ctx, layer.vars))
+		if diags.HasErrors() || evaluated.IsNull() {
+			continue
+		}
+		if layer.fillOnly && countUnknowns(evaluated) >= countUnknowns(val) {
+			continue
+		}
+		if !layer.fillOnly && (evaluated.RawEquals(val) || countUnknowns(evaluated) > countUnknowns(val)) {
+			continue
+		}
+		val, source, found = evaluated, layer.source, true
+	}
+
+	return val, source, found
+}
+
+// referencesRoots reports whether an expression refers to any of the given
+// root names, such as "data" or "local".
+func referencesRoots(expr hcl.Expression, roots ...string) bool {
+	for _, traversal := range expr.Variables() {
+		if slices.Contains(roots, traversal.RootName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getModuleAddress returns the address of the module that a block belongs
+// to, as used in state, such as "module.bucket". It's empty for the root
+// module.
+func (t *terraformConverter) getModuleAddress(b *terraform.Block) string {
+	if moduleBlock := t.getModuleBlock(b); moduleBlock != nil {
+		return moduleBlock.FullName()
+	}
+	return ""
+}
+
+// newOverrideContext returns a child of ctx, where the given variables take
+// precedence over those of ctx.
+func newOverrideContext(ctx *hcl.EvalContext, overrides map[string]cty.Value) *hcl.EvalContext {
+	child := ctx.NewChild()
+	child.Variables = overrides
+	return child
+}
+
+// lookupVariable returns the value of a variable in ctx or its parents.
+func lookupVariable(ctx *hcl.EvalContext, name string) cty.Value {
+	for ; ctx != nil; ctx = ctx.Parent() {
+		if val, ok := ctx.Variables[name]; ok {
+			return val
+		}
+	}
+	return cty.NilVal
+}
+
+// fillUnknowns returns val, with any unknown or missing values filled in
+// from known. Values that are already known are left alone.
+func fillUnknowns(val cty.Value, known cty.Value) cty.Value {
+	if val == cty.NilVal || !val.IsKnown() || val.IsNull() {
+		return known
+	}
+	if val.IsMarked() || known.IsMarked() || !known.IsKnown() || known.IsNull() {
+		return val
+	}
+
+	valType, knownType := val.Type(), known.Type()
+	switch {
+	case (valType.IsObjectType() || valType.IsMapType()) && (knownType.IsObjectType() || knownType.IsMapType()):
+		filled := known.AsValueMap()
+		if filled == nil {
+			filled = map[string]cty.Value{}
+		}
+		for key, v := range val.AsValueMap() {
+			if k, ok := filled[key]; ok {
+				filled[key] = fillUnknowns(v, k)
+			} else {
+				filled[key] = v
+			}
+		}
+		return cty.ObjectVal(filled)
+
+	case (valType.IsTupleType() || valType.IsListType()) && (knownType.IsTupleType() || knownType.IsListType()):
+		vals, knowns := val.AsValueSlice(), known.AsValueSlice()
+		if len(vals) != len(knowns) {
+			return val
+		}
+		filled := make([]cty.Value, len(vals))
+		for i := range vals {
+			filled[i] = fillUnknowns(vals[i], knowns[i])
+		}
+		return cty.TupleVal(filled)
+	}
+
+	return val
+}
+
+// countUnknowns returns the number of unknown values within val.
+func countUnknowns(val cty.Value) int {
+	count := 0
+	val, _ = val.UnmarkDeep()
+	_ = cty.Walk(val, func(_ cty.Path, v cty.Value) (bool, error) {
+		if !v.IsKnown() {
+			count++
+			return false, nil
+		}
+		return true, nil
+	})
+	return count
+}
@@ -0,0 +1,440 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const (
+	// valueSourcePlan marks attribute values that were taken from the
+	// planned values of a plan.
+	valueSourcePlan = "plan"
+	// valueSourcePriorState marks attribute values that were taken from the
+	// prior state of a plan.
+	valueSourcePriorState = "prior_state"
+)
+
+// terraformPlan is the part of the `terraform show -json` output for a plan
+// that's used to fill in values that aren't known from configuration.
+type terraformPlan struct {
+	FormatVersion string `json:"format_version"`
+	PlannedValues struct {
+		RootModule planModule `json:"root_module"`
+	} `json:"planned_values"`
+	PriorState struct {
+		Values struct {
+			RootModule planModule `json:"root_module"`
+		} `json:"values"`
+	} `json:"prior_state"`
+	ResourceChanges []planResourceChange `json:"resource_changes"`
+}
+
+type planModule struct {
+	Resources    []planResource `json:"resources"`
+	ChildModules []planModule   `json:"child_modules"`
+}
+
+type planResource struct {
+	// Address is the address of the resource instance, such as
+	// `module.bucket.aws_s3_bucket.this[0]`.
+	Address string                     `json:"address"`
+	Values  map[string]json.RawMessage `json:"values"`
+}
+
+type planResourceChange struct {
+	Address string `json:"address"`
+	Change  struct {
+		AfterUnknown json.RawMessage `json:"after_unknown"`
+	} `json:"change"`
+}
+
+// planValues are the values from a plan, indexed by resource address.
+type planValues struct {
+	planned map[string]map[string]json.RawMessage
+	prior   map[string]map[string]json.RawMessage
+	// unknown is the after_unknown value of each resource, which is true
+	// for the values that aren't known until apply.
+	unknown      map[string]map[string]any
+	afterUnknown map[string][]string
+}
+
+// readPlanFile reads the JSON output of `terraform show -json` for a plan.
+func readPlanFile(path string) (*planValues, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan file: %w", err)
+	}
+
+	var plan terraformPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("unable to parse plan file %s: %w", path, err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("plan file %s has no format_version, is it the output of `terraform show -json`?", path)
+	}
+
+	values := &planValues{
+		planned:      map[string]map[string]json.RawMessage{},
+		prior:        map[string]map[string]json.RawMessage{},
+		unknown:      map[string]map[string]any{},
+		afterUnknown: map[string][]string{},
+	}
+	plan.PlannedValues.RootModule.index(values.planned)
+	plan.PriorState.Values.RootModule.index(values.prior)
+
+	for _, rc := range plan.ResourceChanges {
+		var afterUnknown any
+		if len(rc.Change.AfterUnknown) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(rc.Change.AfterUnknown, &afterUnknown); err != nil {
+			return nil, fmt.Errorf("unable to parse after_unknown of %s: %w", rc.Address, err)
+		}
+		if attrs, ok := afterUnknown.(map[string]any); ok {
+			values.unknown[rc.Address] = attrs
+		}
+		if paths := getUnknownPaths(afterUnknown, ""); len(paths) > 0 {
+			slices.Sort(paths)
+			values.afterUnknown[rc.Address] = paths
+		}
+	}
+
+	return values, nil
+}
+
+// index adds the values of the resources in a module and its children to
+// values, by resource address.
+func (m planModule) index(values map[string]map[string]json.RawMessage) {
+	for _, r := range m.Resources {
+		values[r.Address] = r.Values
+	}
+	for _, child := range m.ChildModules {
+		child.index(values)
+	}
+}
+
+// getUnknownPaths returns the paths of the values that are marked as unknown
+// in an after_unknown value, such as "arn" or "ingress[0].id".
+func getUnknownPaths(afterUnknown any, prefix string) []string {
+	var paths []string
+	switch v := afterUnknown.(type) {
+	case bool:
+		if v && prefix != "" {
+			paths = append(paths, prefix)
+		}
+	case map[string]any:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			paths = append(paths, getUnknownPaths(child, path)...)
+		}
+	case []any:
+		for i, child := range v {
+			paths = append(paths, getUnknownPaths(child, prefix+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return paths
+}
+
+// getPlanAddress returns the address of a resource or data source as it
+// appears in a plan, such as `module.bucket.aws_s3_bucket.this[0]`. It's
+// empty for any other block.
+func (t *terraformConverter) getPlanAddress(b *terraform.Block) string {
+	if b.Type() != "resource" && b.Type() != "data" {
+		return ""
+	}
+
+	address := b.GetMetadata().String()
+	if module := t.getModuleAddress(b); module != "" {
+		address = module + "." + address
+	}
+	return address
+}
+
+// planBlock is the part of a plan for a resource or data source, or for a
+// block nested in one.
+type planBlock struct {
+	// address is the address of the resource or data source
+	address string
+	planned map[string]json.RawMessage
+	prior   map[string]json.RawMessage
+	unknown map[string]any
+}
+
+// getPlanBlock returns the part of the plan for a resource or data source, or
+// nil if there's no plan or b is any other block.
+func (t *terraformConverter) getPlanBlock(b *terraform.Block) *planBlock {
+	if t.plan == nil {
+		return nil
+	}
+	address := t.getPlanAddress(b)
+	if address == "" {
+		return nil
+	}
+	return &planBlock{
+		address: address,
+		planned: t.plan.planned[address],
+		prior:   t.plan.prior[address],
+		unknown: t.plan.unknown[address],
+	}
+}
+
+// getNestedPlanBlock returns the part of the plan for the index'th nested
+// block of its type in parent, or nil if the plan doesn't have it. Nested
+// blocks that are sets, such as ingress, aren't in the order of the
+// configuration in the plan, so the block is matched to the one in the plan
+// that has the same known attribute values.
+func (t *terraformConverter) getNestedPlanBlock(parent *planBlock, b *terraform.Block, index int) *planBlock {
+	if parent == nil {
+		return nil
+	}
+
+	nested := &planBlock{address: parent.address}
+	i := t.matchNestedPlanBlock(b, parent.planned[b.Type()], index)
+	if i >= 0 {
+		nested.planned = getNestedPlanValues(parent.planned[b.Type()], i)
+		if unknown, ok := parent.unknown[b.Type()].([]any); ok && i < len(unknown) {
+			nested.unknown, _ = unknown[i].(map[string]any)
+		}
+	}
+	if i := t.matchNestedPlanBlock(b, parent.prior[b.Type()], index); i >= 0 {
+		nested.prior = getNestedPlanValues(parent.prior[b.Type()], i)
+	}
+	return nested
+}
+
+// matchNestedPlanBlock returns the index of the nested block in raw, the
+// value of the nested blocks of b's type in a plan, that has the same known
+// attribute values as b, preferring the index'th block. It returns -1 if
+// there's no such block, or more than one other than the index'th.
+func (t *terraformConverter) matchNestedPlanBlock(b *terraform.Block, raw json.RawMessage, index int) int {
+	var blocks []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return -1
+	}
+
+	matches := []int{}
+	for i, values := range blocks {
+		if t.planValuesMatch(b, values) {
+			if i == index {
+				return i
+			}
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) != 1 {
+		return -1
+	}
+	return matches[0]
+}
+
+// planValuesMatch reports whether the attributes of b that are known from
+// configuration have the same values in the values of a nested block in a
+// plan.
+func (t *terraformConverter) planValuesMatch(b *terraform.Block, values map[string]json.RawMessage) bool {
+	for _, a := range b.GetAttributes() {
+		config := t.withoutPlaceholders(a.Value())
+		if config.IsMarked() || !config.IsWhollyKnown() || config.IsNull() || !config.Type().IsPrimitiveType() {
+			continue
+		}
+		raw, ok := values[a.Name()]
+		if !ok {
+			continue
+		}
+		val, err := unmarshalCtyJSON(raw)
+		if err != nil || val.IsNull() {
+			return false
+		}
+		converted, err := convert.Convert(val, config.Type())
+		if err != nil || !converted.Equals(config).True() {
+			return false
+		}
+	}
+	return true
+}
+
+// getNestedPlanValues returns the values of the i'th nested block in raw, the
+// value of the nested blocks of a type in a plan.
+func getNestedPlanValues(raw json.RawMessage, i int) map[string]json.RawMessage {
+	var blocks []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &blocks); err != nil || i >= len(blocks) {
+		return nil
+	}
+	return blocks[i]
+}
+
+// getPlanValue returns the value of an attribute with the parts that aren't
+// known from configuration, which current represents with placeholders,
+// filled in from the plan. The planned value is preferred to the prior state,
+// and the parts that the plan says are unknown until apply are left alone.
+func (t *terraformConverter) getPlanValue(plan *planBlock, a *terraform.Attribute, config cty.Value, current any) (any, string, bool) {
+	if plan == nil || config == cty.NilVal {
+		return nil, "", false
+	}
+
+	config = t.withoutPlaceholders(config)
+	if config.IsWhollyKnown() {
+		return nil, "", false
+	}
+
+	for _, source := range []struct {
+		name   string
+		values map[string]json.RawMessage
+	}{
+		{valueSourcePlan, plan.planned},
+		{valueSourcePriorState, plan.prior},
+	} {
+		raw, ok := source.values[a.Name()]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		val, err := unmarshalCtyJSON(raw)
+		if err != nil {
+			t.logger.Error("unable to read value from plan", "address", plan.address, "name", a.Name(), "error", err)
+			continue
+		}
+		if native, ok := overlayPlanValue(config, val, current, plan.unknown[a.Name()]); ok {
+			return native, source.name, true
+		}
+		return nil, "", false
+	}
+	return nil, "", false
+}
+
+// getConfigValue returns the value of an attribute from configuration, or an
+// unknown value if the parser couldn't evaluate it.
+func (t *terraformConverter) getConfigValue(b *terraform.Block, a *terraform.Attribute) cty.Value {
+	val := a.Value()
+	if t.plan == nil || b.Context() == nil || !val.IsWhollyKnown() {
+		return val
+	}
+
+	hclAttr, err := t.adapter.HCLAttribute(a)
+	if err != nil {
+		return val
+	}
+	if _, diags := hclAttr.Expr.Value(b.Context().Inner()); diags.HasErrors() {
+		return cty.DynamicVal
+	}
+	return val
+}
+
+// withoutPlaceholders returns val with each string that contains the ID of a
+// block, which the parser uses in place of values such as id and arn that
+// aren't known until apply, replaced by an unknown string.
+func (t *terraformConverter) withoutPlaceholders(val cty.Value) cty.Value {
+	if t.blockIDs == nil {
+		t.blockIDs = stringSet{}
+		for _, m := range t.modules {
+			for _, b := range m.GetBlocks() {
+				t.blockIDs.Add(b.ID())
+			}
+		}
+	}
+
+	val, _ = cty.Transform(val, func(_ cty.Path, v cty.Value) (cty.Value, error) {
+		if !v.IsKnown() || v.IsNull() || v.IsMarked() || v.Type() != cty.String {
+			return v, nil
+		}
+		for _, id := range blockIDPattern.FindAllString(v.AsString(), -1) {
+			if t.blockIDs[id] {
+				return cty.UnknownVal(cty.String), nil
+			}
+		}
+		return v, nil
+	})
+	return val
+}
+
+// blockIDPattern matches the IDs that the parser gives blocks.
+var blockIDPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// overlayPlanValue returns current, the native form of a value from
+// configuration, with each part that isn't known in config replaced by the
+// same part of the value from the plan. afterUnknown is the matching part of
+// the plan's after_unknown, which is true where the plan doesn't know the
+// value either. It reports whether any part was replaced.
+func overlayPlanValue(config cty.Value, plan cty.Value, current any, afterUnknown any) (any, bool) {
+	if unknown, _ := afterUnknown.(bool); unknown || config.IsWhollyKnown() || config.IsMarked() || plan.IsNull() {
+		return current, false
+	}
+	if !config.IsKnown() {
+		return convertCtyToNativeValue(plan)
+	}
+
+	switch {
+	case config.Type().IsObjectType() || config.Type().IsMapType():
+		currentMap, ok := current.(map[string]any)
+		if !ok || !(plan.Type().IsObjectType() || plan.Type().IsMapType()) {
+			return current, false
+		}
+		planMap := plan.AsValueMap()
+		unknownMap, _ := afterUnknown.(map[string]any)
+		result := make(map[string]any, len(currentMap))
+		replaced := false
+		for key, value := range currentMap {
+			result[key] = value
+			configValue, ok := configAttribute(config, key)
+			if !ok {
+				continue
+			}
+			if planValue, ok := planMap[key]; ok {
+				var changed bool
+				result[key], changed = overlayPlanValue(configValue, planValue, value, unknownMap[key])
+				replaced = replaced || changed
+			}
+		}
+		return result, replaced
+	case config.Type().IsListType() || config.Type().IsTupleType():
+		currentSlice, ok := current.([]any)
+		if !ok || !(plan.Type().IsListType() || plan.Type().IsTupleType()) {
+			return current, false
+		}
+		configSlice := config.AsValueSlice()
+		planSlice := plan.AsValueSlice()
+		if len(currentSlice) != len(configSlice) {
+			return current, false
+		}
+		unknownSlice, _ := afterUnknown.([]any)
+		result := slices.Clone(currentSlice)
+		replaced := false
+		for i := range min(len(configSlice), len(planSlice)) {
+			var unknown any
+			if i < len(unknownSlice) {
+				unknown = unknownSlice[i]
+			}
+			var changed bool
+			result[i], changed = overlayPlanValue(configSlice[i], planSlice[i], currentSlice[i], unknown)
+			replaced = replaced || changed
+		}
+		return result, replaced
+	}
+	return current, false
+}
+
+// configAttribute returns the value of a key of an object or a map.
+func configAttribute(val cty.Value, key string) (cty.Value, bool) {
+	if val.Type().IsObjectType() {
+		if !val.Type().HasAttribute(key) {
+			return cty.NilVal, false
+		}
+		return val.GetAttr(key), true
+	}
+	if !val.HasIndex(cty.StringVal(key)).True() {
+		return cty.NilVal, false
+	}
+	return val.Index(cty.StringVal(key)), true
+}
@@ -0,0 +1,421 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// policyDocumentVersion is the default version of a policy document, which
+// uses &{...} in place of ${...} for policy variables.
+const policyDocumentVersion = "2012-10-17"
+
+// policyDocument is an IAM policy document, which marshals to the same JSON
+// as the aws_iam_policy_document data source of the AWS provider.
+type policyDocument struct {
+	Version    string             `json:",omitempty"`
+	Id         string             `json:",omitempty"`
+	Statements []*policyStatement `json:"Statement,omitempty"`
+}
+
+type policyStatement struct {
+	Sid           string           `json:",omitempty"`
+	Effect        string           `json:",omitempty"`
+	Actions       any              `json:"Action,omitempty"`
+	NotActions    any              `json:"NotAction,omitempty"`
+	Resources     any              `json:"Resource,omitempty"`
+	NotResources  any              `json:"NotResource,omitempty"`
+	Principals    policyPrincipals `json:"Principal,omitempty"`
+	NotPrincipals policyPrincipals `json:"NotPrincipal,omitempty"`
+	Conditions    policyConditions `json:"Condition,omitempty"`
+}
+
+type policyPrincipal struct {
+	Type        string
+	Identifiers any
+}
+
+type policyPrincipals []policyPrincipal
+
+type policyCondition struct {
+	Test     string
+	Variable string
+	Values   any
+}
+
+type policyConditions []policyCondition
+
+// emulatePolicyDocument renders an aws_iam_policy_document data source to its
+// json and minified_json attributes, the way the AWS provider does.
+func (t *terraformConverter) emulatePolicyDocument(b *terraform.Block, vars map[string]cty.Value) (map[string]cty.Value, error) {
+	merged := &policyDocument{}
+
+	sources, err := t.evaluateStrings(b, "source_policy_documents", vars)
+	if err != nil {
+		return nil, err
+	}
+	sids := map[string]bool{}
+	for _, source := range sources {
+		doc, err := unmarshalPolicyDocument(source)
+		if err != nil {
+			return nil, fmt.Errorf("source_policy_documents: %w", err)
+		}
+		for _, stmt := range doc.Statements {
+			if stmt.Sid == "" {
+				continue
+			}
+			if sids[stmt.Sid] {
+				return nil, fmt.Errorf("duplicate Sid %q in source_policy_documents", stmt.Sid)
+			}
+			sids[stmt.Sid] = true
+		}
+		merged.merge(doc)
+	}
+
+	doc, err := t.buildPolicyDocument(b, vars)
+	if err != nil {
+		return nil, err
+	}
+	merged.merge(doc)
+
+	overrides, err := t.evaluateStrings(b, "override_policy_documents", vars)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		doc, err := unmarshalPolicyDocument(override)
+		if err != nil {
+			return nil, fmt.Errorf("override_policy_documents: %w", err)
+		}
+		merged.merge(doc)
+	}
+
+	indented, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	minified, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]cty.Value{
+		"json":          cty.StringVal(string(indented)),
+		"minified_json": cty.StringVal(string(minified)),
+	}, nil
+}
+
+func (t *terraformConverter) buildPolicyDocument(b *terraform.Block, vars map[string]cty.Value) (*policyDocument, error) {
+	doc := &policyDocument{Version: policyDocumentVersion}
+	if version, err := t.evaluateString(b, "version", vars); err != nil {
+		return nil, err
+	} else if version != "" {
+		doc.Version = version
+	}
+	id, err := t.evaluateString(b, "policy_id", vars)
+	if err != nil {
+		return nil, err
+	}
+	doc.Id = id
+
+	sids := map[string]bool{}
+	for _, sb := range b.GetBlocks("statement") {
+		stmt := &policyStatement{Effect: "Allow"}
+
+		if stmt.Sid, err = t.evaluateString(sb, "sid", vars); err != nil {
+			return nil, err
+		}
+		if stmt.Sid != "" {
+			if sids[stmt.Sid] {
+				return nil, fmt.Errorf("duplicate Sid %q", stmt.Sid)
+			}
+			sids[stmt.Sid] = true
+		}
+		if effect, err := t.evaluateString(sb, "effect", vars); err != nil {
+			return nil, err
+		} else if effect != "" {
+			stmt.Effect = effect
+		}
+
+		for name, field := range map[string]*any{
+			"actions":       &stmt.Actions,
+			"not_actions":   &stmt.NotActions,
+			"resources":     &stmt.Resources,
+			"not_resources": &stmt.NotResources,
+		} {
+			values, err := t.evaluateStrings(sb, name, vars)
+			if err != nil {
+				return nil, err
+			}
+			if len(values) > 0 {
+				*field = policyStringList(replacePolicyVariables(values, doc.Version))
+			}
+		}
+
+		if stmt.Principals, err = t.buildPolicyPrincipals(sb, "principals", doc.Version, vars); err != nil {
+			return nil, err
+		}
+		if stmt.NotPrincipals, err = t.buildPolicyPrincipals(sb, "not_principals", doc.Version, vars); err != nil {
+			return nil, err
+		}
+
+		for _, cb := range sb.GetBlocks("condition") {
+			var cond policyCondition
+			if cond.Test, err = t.evaluateString(cb, "test", vars); err != nil {
+				return nil, err
+			}
+			if cond.Variable, err = t.evaluateString(cb, "variable", vars); err != nil {
+				return nil, err
+			}
+			values, err := t.evaluateStrings(cb, "values", vars)
+			if err != nil {
+				return nil, err
+			}
+			cond.Values = policyStringList(replacePolicyVariables(values, doc.Version))
+			stmt.Conditions = append(stmt.Conditions, cond)
+		}
+
+		doc.Statements = append(doc.Statements, stmt)
+	}
+
+	return doc, nil
+}
+
+func (t *terraformConverter) buildPolicyPrincipals(b *terraform.Block, blockType string, version string, vars map[string]cty.Value) (policyPrincipals, error) {
+	var principals policyPrincipals
+	for _, pb := range b.GetBlocks(blockType) {
+		principalType, err := t.evaluateString(pb, "type", vars)
+		if err != nil {
+			return nil, err
+		}
+		identifiers, err := t.evaluateStrings(pb, "identifiers", vars)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, policyPrincipal{
+			Type:        principalType,
+			Identifiers: policyStringList(replacePolicyVariables(identifiers, version)),
+		})
+	}
+	return principals, nil
+}
+
+// evaluateString evaluates a string attribute of a block with the given
+// variables. It's empty if the block doesn't have the attribute.
+func (t *terraformConverter) evaluateString(b *terraform.Block, name string, vars map[string]cty.Value) (string, error) {
+	val, err := t.evaluateWith(b, name, vars)
+	if err != nil || val == cty.NilVal || val.IsNull() {
+		return "", err
+	}
+	val, _ = val.UnmarkDeep()
+	if !val.Type().Equals(cty.String) {
+		return "", fmt.Errorf("%s must be a string, got %s", name, val.Type().FriendlyName())
+	}
+	return val.AsString(), nil
+}
+
+// evaluateStrings evaluates a list or set of strings attribute of a block with
+// the given variables.
+func (t *terraformConverter) evaluateStrings(b *terraform.Block, name string, vars map[string]cty.Value) ([]string, error) {
+	val, err := t.evaluateWith(b, name, vars)
+	if err != nil || val == cty.NilVal || val.IsNull() {
+		return nil, err
+	}
+	val, _ = val.UnmarkDeep()
+	if !val.CanIterateElements() || val.Type().IsMapType() || val.Type().IsObjectType() {
+		return nil, fmt.Errorf("%s must be a list of strings, got %s", name, val.Type().FriendlyName())
+	}
+
+	var values []string
+	for _, v := range val.AsValueSlice() {
+		if v.IsNull() || !v.Type().Equals(cty.String) {
+			return nil, fmt.Errorf("%s must be a list of strings, got %s", name, v.Type().FriendlyName())
+		}
+		values = append(values, v.AsString())
+	}
+	return values, nil
+}
+
+// replacePolicyVariables replaces &{...} with ${...} in policy documents of
+// the version that supports policy variables, since ${...} can't be written
+// in Terraform strings without escaping.
+func replacePolicyVariables(values []string, version string) []string {
+	if version != policyDocumentVersion {
+		return values
+	}
+	replaced := make([]string, len(values))
+	for i, v := range values {
+		replaced[i] = strings.ReplaceAll(v, "&{", "${")
+	}
+	return replaced
+}
+
+// policyStringList returns a single value as a string, and more values as a
+// list in reverse order, like the AWS provider.
+func policyStringList(values []string) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	sorted := slices.Clone(values)
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	return sorted
+}
+
+func unmarshalPolicyDocument(data string) (*policyDocument, error) {
+	doc := &policyDocument{}
+	if err := json.Unmarshal([]byte(data), doc); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	return doc, nil
+}
+
+// merge merges another policy document into this one. Statements with the
+// same Sid are replaced, and any other statements are appended.
+func (d *policyDocument) merge(other *policyDocument) {
+	if other.Id != "" {
+		d.Id = other.Id
+	}
+	if other.Version > d.Version {
+		d.Version = other.Version
+	}
+
+	for _, stmt := range other.Statements {
+		idx := -1
+		if stmt.Sid != "" {
+			idx = slices.IndexFunc(d.Statements, func(s *policyStatement) bool {
+				return s.Sid == stmt.Sid
+			})
+		}
+		if idx >= 0 {
+			d.Statements[idx] = stmt
+		} else {
+			d.Statements = append(d.Statements, stmt)
+		}
+	}
+}
+
+func (ps policyPrincipals) MarshalJSON() ([]byte, error) {
+	// a single wildcard principal is written as "*" rather than {"*": "*"}
+	if len(ps) == 1 && ps[0].Type == "*" {
+		switch ids := ps[0].Identifiers.(type) {
+		case string:
+			if ids == "*" {
+				return []byte(`"*"`), nil
+			}
+		case []string:
+			if len(ids) == 1 && ids[0] == "*" {
+				return []byte(`"*"`), nil
+			}
+		}
+	}
+
+	raw := map[string]any{}
+	for _, p := range ps {
+		raw[p.Type] = appendPolicyValues(raw[p.Type], p.Identifiers)
+	}
+	return json.Marshal(raw)
+}
+
+func (ps *policyPrincipals) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case string:
+		*ps = append(*ps, policyPrincipal{Type: "*", Identifiers: v})
+	case map[string]any:
+		for _, principalType := range slices.Sorted(maps.Keys(v)) {
+			identifiers, err := unmarshalPolicyValues(v[principalType])
+			if err != nil {
+				return fmt.Errorf("principal %s: %w", principalType, err)
+			}
+			*ps = append(*ps, policyPrincipal{Type: principalType, Identifiers: identifiers})
+		}
+	default:
+		return fmt.Errorf("unexpected principal %v", raw)
+	}
+	return nil
+}
+
+func (cs policyConditions) MarshalJSON() ([]byte, error) {
+	raw := map[string]map[string]any{}
+	for _, c := range cs {
+		if raw[c.Test] == nil {
+			raw[c.Test] = map[string]any{}
+		}
+		raw[c.Test][c.Variable] = appendPolicyValues(raw[c.Test][c.Variable], c.Values)
+	}
+	return json.Marshal(raw)
+}
+
+func (cs *policyConditions) UnmarshalJSON(data []byte) error {
+	var raw map[string]map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for _, test := range slices.Sorted(maps.Keys(raw)) {
+		for _, variable := range slices.Sorted(maps.Keys(raw[test])) {
+			values, err := unmarshalPolicyValues(raw[test][variable])
+			if err != nil {
+				return fmt.Errorf("condition %s %s: %w", test, variable, err)
+			}
+			*cs = append(*cs, policyCondition{Test: test, Variable: variable, Values: values})
+		}
+	}
+	return nil
+}
+
+// appendPolicyValues appends values, which is a string or a list of strings,
+// to existing values, keeping a single value as a string.
+func appendPolicyValues(existing any, values any) any {
+	var list []string
+	switch v := existing.(type) {
+	case nil:
+		if s, ok := values.(string); ok {
+			return s
+		}
+	case string:
+		list = append(list, v)
+	case []string:
+		list = append(list, v...)
+	}
+
+	switch v := values.(type) {
+	case string:
+		list = append(list, v)
+	case []string:
+		list = append(list, v...)
+	}
+	return list
+}
+
+// unmarshalPolicyValues converts a string or list of strings from a JSON
+// policy document.
+func unmarshalPolicyValues(raw any) (any, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected value %v", item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected value %v", raw)
+}
@@ -26,3 +26,13 @@ func (i relativeResolveFs) Path() string {
 }
 
 var _ fs.FS = new(relativeResolveFs)
+
+// resolvePath returns the path of a file that is given relative to the root
+// module, like Terraform does for the paths of variable files, or the path
+// itself if it's absolute.
+func resolvePath(rootDir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(rootDir, path)
+}
@@ -0,0 +1,145 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// remoteStateKeys are the settings that identify a state within a backend, by
+// backend type. The remote and cloud backends are identified by workspace
+// name instead.
+var remoteStateKeys = map[string]string{
+	"azurerm":    "key",
+	"consul":     "path",
+	"cos":        "key",
+	"gcs":        "prefix",
+	"http":       "address",
+	"kubernetes": "secret_suffix",
+	"local":      "path",
+	"oss":        "key",
+	"pg":         "schema_name",
+	"s3":         "key",
+}
+
+// errNoRemoteStateFile is returned when none of the local state files match
+// a terraform_remote_state data source.
+var errNoRemoteStateFile = errors.New("no local state file for remote state")
+
+// emulateRemoteState reads the outputs of a terraform_remote_state data
+// source from a local state file, merged over its defaults.
+func (t *terraformConverter) emulateRemoteState(b *terraform.Block, vars map[string]cty.Value) (map[string]cty.Value, error) {
+	backend, err := t.evaluateString(b, "backend", vars)
+	if err != nil {
+		return nil, err
+	}
+	config, err := t.evaluateWith(b, "config", vars)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := t.evaluateString(b, "workspace", vars)
+	if err != nil {
+		return nil, err
+	}
+	if workspace == "" {
+		workspace = "default"
+	}
+
+	path, err := t.findRemoteStateFile(backend, config, workspace)
+	if err != nil {
+		return nil, err
+	}
+	state, err := t.readRemoteState(path)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := state.outputs()
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := t.evaluateWith(b, "defaults", vars)
+	if err != nil {
+		return nil, err
+	}
+	if defaults != cty.NilVal && !defaults.IsNull() {
+		outputs = replaceAttributes(defaults, outputs)
+	}
+
+	return map[string]cty.Value{"outputs": outputs}, nil
+}
+
+// findRemoteStateFile returns the path of the local state file for a remote
+// state. The files given with WithRemoteStateFiles are matched first, by
+// backend and key, then the state files of WithRemoteStateDir by workspace
+// name. The local backend's own path is used if nothing else matches.
+func (t *terraformConverter) findRemoteStateFile(backend string, config cty.Value, workspace string) (string, error) {
+	key := ""
+	switch backend {
+	case "remote", "cloud":
+		if name := configString(config, "workspaces", "name"); name != "" {
+			workspace = name
+		} else {
+			workspace = configString(config, "workspaces", "prefix") + workspace
+		}
+		key = workspace
+	default:
+		if setting, ok := remoteStateKeys[backend]; ok {
+			key = configString(config, setting)
+		}
+	}
+
+	if path, ok := t.remoteStateFiles[backend+":"+key]; ok && key != "" {
+		return path, nil
+	}
+
+	if t.remoteStateDir != "" {
+		for _, path := range []string{
+			filepath.Join(t.remoteStateDir, workspace+".tfstate"),
+			filepath.Join(t.remoteStateDir, workspace, "terraform.tfstate"),
+		} {
+			if _, err := os.Stat(resolvePath(t.filePath, path)); err == nil {
+				return path, nil
+			}
+		}
+	}
+
+	if backend == "local" && key != "" {
+		return key, nil
+	}
+	return "", fmt.Errorf("%w: backend %s, key %q, workspace %q", errNoRemoteStateFile, backend, key, workspace)
+}
+
+// readRemoteState reads a state file for a remote state. Each file is only
+// read once.
+func (t *terraformConverter) readRemoteState(path string) (*terraformState, error) {
+	resolved := resolvePath(t.filePath, path)
+	if state, ok := t.remoteStates[resolved]; ok {
+		return state, nil
+	}
+
+	state, err := readStateFile(resolved)
+	if err != nil {
+		return nil, err
+	}
+	t.remoteStates[resolved] = state
+	return state, nil
+}
+
+// configString returns the string at the given path within an object, or an
+// empty string if there isn't one.
+func configString(val cty.Value, path ...string) string {
+	for _, name := range path {
+		val = valueMap(val)[name]
+	}
+	if val == cty.NilVal || !val.IsKnown() || val.IsNull() || val.IsMarked() || !val.Type().Equals(cty.String) {
+		return ""
+	}
+	return val.AsString()
+}
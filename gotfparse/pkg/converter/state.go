@@ -0,0 +1,193 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// valueSourceState marks attribute values that were filled in from state.
+const valueSourceState = "state"
+
+// terraformState is the part of a terraform.tfstate file that's used to fill
+// in values that aren't known until apply time.
+type terraformState struct {
+	Version   int                    `json:"version"`
+	Outputs   map[string]stateOutput `json:"outputs"`
+	Resources []stateResource        `json:"resources"`
+}
+
+// stateOutput is an output value of the root module.
+type stateOutput struct {
+	Value json.RawMessage `json:"value"`
+	Type  json.RawMessage `json:"type"`
+}
+
+type stateResource struct {
+	// Module is the address of the module that the resource belongs to, such
+	// as "module.bucket", or empty for the root module.
+	Module    string          `json:"module"`
+	Mode      string          `json:"mode"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Instances []stateInstance `json:"instances"`
+}
+
+type stateInstance struct {
+	// IndexKey is the count index or for_each key of the instance, if any.
+	IndexKey   any             `json:"index_key"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+// readStateFile reads a terraform state file.
+func readStateFile(path string) (*terraformState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file: %w", err)
+	}
+
+	var state terraformState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %w", path, err)
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("unsupported state file version %d in %s", state.Version, path)
+	}
+
+	return &state, nil
+}
+
+// variables returns the values of the resources and data sources in a module
+// as they would be referred to in an expression, such as
+// {"aws_s3_bucket": {"example": {...}}, "data": {"aws_caller_identity": {...}}}.
+func (s *terraformState) variables(module string) (map[string]cty.Value, error) {
+	resources := map[string]map[string]cty.Value{}
+	data := map[string]map[string]cty.Value{}
+
+	for _, r := range s.Resources {
+		if r.Module != module {
+			continue
+		}
+
+		val, err := r.value()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s.%s from state: %w", r.Type, r.Name, err)
+		}
+
+		byType := resources
+		if r.Mode == "data" {
+			byType = data
+		}
+		if byType[r.Type] == nil {
+			byType[r.Type] = map[string]cty.Value{}
+		}
+		byType[r.Type][r.Name] = val
+	}
+
+	vars := map[string]cty.Value{}
+	for typeName, byName := range resources {
+		vars[typeName] = cty.ObjectVal(byName)
+	}
+	if len(data) > 0 {
+		dataVars := map[string]cty.Value{}
+		for typeName, byName := range data {
+			dataVars[typeName] = cty.ObjectVal(byName)
+		}
+		vars["data"] = cty.ObjectVal(dataVars)
+	}
+	return vars, nil
+}
+
+// outputs returns the output values of the root module, as they would be
+// referred to by the outputs of a terraform_remote_state data source.
+func (s *terraformState) outputs() (cty.Value, error) {
+	outputs := map[string]cty.Value{}
+	for name, output := range s.Outputs {
+		val, err := output.value()
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("unable to read output %s from state: %w", name, err)
+		}
+		outputs[name] = val
+	}
+	return cty.ObjectVal(outputs), nil
+}
+
+func (o stateOutput) value() (cty.Value, error) {
+	if len(o.Type) == 0 {
+		return unmarshalCtyJSON(o.Value)
+	}
+	ty, err := ctyjson.UnmarshalType(o.Type)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(o.Value, ty)
+}
+
+// value returns the attributes of a resource's instances. Resources using
+// count are a tuple of instances by index, where the indexes that aren't in
+// state, such as those that were removed with terraform state rm, are
+// unknown. Resources using for_each are an object of instances keyed by their
+// key, and other resources a single instance.
+func (r stateResource) value() (cty.Value, error) {
+	if len(r.Instances) == 1 && r.Instances[0].IndexKey == nil {
+		return r.Instances[0].value()
+	}
+
+	byIndex := map[int]cty.Value{}
+	byKey := map[string]cty.Value{}
+	for _, inst := range r.Instances {
+		val, err := inst.value()
+		if err != nil {
+			return cty.NilVal, err
+		}
+
+		switch key := inst.IndexKey.(type) {
+		case float64:
+			byIndex[int(key)] = val
+		case string:
+			byKey[key] = val
+		default:
+			return cty.NilVal, fmt.Errorf("unexpected index key %v", key)
+		}
+	}
+
+	if len(byKey) > 0 {
+		return cty.ObjectVal(byKey), nil
+	}
+
+	instances := []cty.Value{}
+	if len(byIndex) > 0 {
+		instances = make([]cty.Value, slices.Max(slices.Collect(maps.Keys(byIndex)))+1)
+	}
+	for idx := range instances {
+		if val, ok := byIndex[idx]; ok {
+			instances[idx] = val
+		} else {
+			instances[idx] = cty.DynamicVal
+		}
+	}
+	return cty.TupleVal(instances), nil
+}
+
+func (i stateInstance) value() (cty.Value, error) {
+	return unmarshalCtyJSON(i.Attributes)
+}
+
+// unmarshalCtyJSON converts a JSON value to a cty value of its implied type.
+func unmarshalCtyJSON(data json.RawMessage) (cty.Value, error) {
+	if len(data) == 0 {
+		return cty.EmptyObjectVal, nil
+	}
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
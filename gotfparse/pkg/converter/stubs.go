@@ -0,0 +1,175 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// valueSourceStub marks attribute values that were worked out from data
+// source stubs.
+const valueSourceStub = "stub"
+
+// dataSourceStubs are stand-in values for the attributes of data sources, by
+// data source type and attribute name.
+type dataSourceStubs map[string]map[string]cty.Value
+
+// readDataSourceStubs reads data source stubs from a YAML or JSON file, which
+// maps data source types to attributes and their values:
+//
+//	aws_caller_identity:
+//	  account_id: "123456789012"
+//	aws_region.name: us-east-1
+func readDataSourceStubs(path string) (dataSourceStubs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read data source stubs: %w", err)
+	}
+
+	// JSON is a subset of YAML, so the same converter reads both
+	ty, err := ctyyaml.Standard.ImpliedType(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse data source stubs %s: %w", path, err)
+	}
+	val, err := ctyyaml.Standard.Unmarshal(data, ty)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse data source stubs %s: %w", path, err)
+	}
+	if !val.Type().IsObjectType() || val.IsNull() {
+		return nil, fmt.Errorf("data source stubs in %s must map data source types to attributes", path)
+	}
+
+	stubs := dataSourceStubs{}
+	for key, v := range val.AsValueMap() {
+		if typeName, attr, ok := strings.Cut(key, "."); ok {
+			stubs.add(typeName, attr, v)
+			continue
+		}
+		if !v.Type().IsObjectType() || v.IsNull() {
+			return nil, fmt.Errorf("data source stubs for %s in %s must map attributes to values", key, path)
+		}
+		for attr, attrVal := range v.AsValueMap() {
+			stubs.add(key, attr, attrVal)
+		}
+	}
+	return stubs, nil
+}
+
+func (s dataSourceStubs) add(typeName string, attr string, val cty.Value) {
+	if s[typeName] == nil {
+		s[typeName] = map[string]cty.Value{}
+	}
+	s[typeName][attr] = val
+}
+
+// stubDataSources returns the value of a module's "data" variable, with the
+// attributes of its stubbed data sources replaced by their stubs. It returns
+// false if none of the module's data sources are stubbed.
+func (t *terraformConverter) stubDataSources(blocks terraform.Blocks, data cty.Value) (cty.Value, bool) {
+	if len(t.stubs) == 0 {
+		return cty.NilVal, false
+	}
+
+	stubbed := false
+	for _, b := range blocks {
+		stubs, ok := t.stubs[b.TypeLabel()]
+		if b.Type() != "data" || !ok {
+			continue
+		}
+		data = setDataSourceValue(data, b, replaceAttributes(b.Values(), cty.ObjectVal(stubs)))
+		stubbed = true
+	}
+	return data, stubbed
+}
+
+// getStubValues returns the stubs for the attributes of a data source, if its
+// type is stubbed.
+func (t *terraformConverter) getStubValues(b *terraform.Block) map[string]cty.Value {
+	if b.Type() != "data" {
+		return nil
+	}
+	return t.stubs[b.TypeLabel()]
+}
+
+// setDataSourceValue returns data, the value of a module's "data" variable,
+// with the value of a data source instance replaced.
+func setDataSourceValue(data cty.Value, b *terraform.Block, val cty.Value) cty.Value {
+	types := valueMap(data)
+	byName := valueMap(types[b.TypeLabel()])
+	byName[b.NameLabel()] = setInstanceValue(byName[b.NameLabel()], b, val)
+	types[b.TypeLabel()] = cty.ObjectVal(byName)
+	return cty.ObjectVal(types)
+}
+
+// setInstanceValue returns instances, the value of all instances of a block,
+// with the value of the given block instance replaced. Blocks using count are
+// a tuple of instances, blocks using for_each an object of instances keyed by
+// their key, and other blocks a single instance.
+func setInstanceValue(instances cty.Value, b *terraform.Block, val cty.Value) cty.Value {
+	ref := b.Reference()
+	key := ref.RawKey()
+	if key == cty.NilVal || key.IsNull() || !key.IsKnown() {
+		return val
+	}
+
+	switch {
+	case b.GetAttribute("count") != nil && key.Type().Equals(cty.Number):
+		if instances == cty.NilVal || !instances.Type().IsTupleType() || instances.IsNull() {
+			return instances
+		}
+		idx, _ := key.AsBigFloat().Int64()
+		elems := instances.AsValueSlice()
+		if idx < 0 || int(idx) >= len(elems) {
+			return instances
+		}
+		elems[idx] = val
+		return cty.TupleVal(elems)
+
+	case b.GetAttribute("for_each") != nil:
+		elems := valueMap(instances)
+		elems[ref.Key()] = val
+		return cty.ObjectVal(elems)
+	}
+
+	return val
+}
+
+// replaceAttributes returns val, with the attributes of replacement in place
+// of its own.
+func replaceAttributes(val cty.Value, replacement cty.Value) cty.Value {
+	if val == cty.NilVal || !val.IsKnown() || val.IsNull() {
+		return replacement
+	}
+	if val.IsMarked() || !(val.Type().IsObjectType() || val.Type().IsMapType()) {
+		return val
+	}
+
+	attrs := map[string]cty.Value{}
+	for k, v := range val.AsValueMap() {
+		attrs[k] = v
+	}
+	for k, v := range replacement.AsValueMap() {
+		attrs[k] = v
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// valueMap returns a copy of the attributes of an object or the elements of a
+// map, or an empty map if val isn't a known object or map.
+func valueMap(val cty.Value) map[string]cty.Value {
+	attrs := map[string]cty.Value{}
+	if val == cty.NilVal || !val.IsKnown() || val.IsNull() || val.IsMarked() {
+		return attrs
+	}
+	if val.Type().IsObjectType() || val.Type().IsMapType() {
+		maps.Copy(attrs, val.AsValueMap())
+	}
+	return attrs
+}
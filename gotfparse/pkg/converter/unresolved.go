@@ -0,0 +1,612 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/scanners/terraform/parser/funcs"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// unresolvedKey is the key of the objects that stand in for values that
+// couldn't be resolved, such as {"__unresolved__": "var.name"}.
+const unresolvedKey = "__unresolved__"
+
+// unknownKey marks the typed representation of an unknown value, which is
+// used in place of markers with WithTypedUnknowns.
+const unknownKey = "__unknown__"
+
+// oneOfKey is the key of the objects that list the possible values of
+// conditional expressions with conditions that aren't known, with
+// WithConditionalBranches.
+const oneOfKey = "__one_of__"
+
+// Placeholders for unresolved values are a random number that's the same
+// for each call, followed by the index of the value, between two characters
+// from the supplementary private use area of unicode. Functions such as
+// upper, format and jsonencode leave them alone.
+const (
+	placeholderStart = "\U000F0000"
+	placeholderEnd   = "\U000F0001"
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\x{F0000}(\d{12})(\d+)\x{F0001}`)
+	// jsonPlaceholderPattern matches placeholders that were encoded as JSON
+	// strings by functions such as jsonencode, on their own or as the value
+	// of a marker
+	jsonPlaceholderPattern = regexp.MustCompile(`(\{"` + unresolvedKey + `":)?"(\x{F0000}\d{12}\d+\x{F0001})"(\})?`)
+	// jsonListPlaceholderPattern matches the placeholders of whole lists that
+	// were encoded as JSON
+	jsonListPlaceholderPattern = regexp.MustCompile(`\["(\x{F0000}\d{12}\d+\x{F0001})"\]`)
+)
+
+// placeholderArgs are the functions that can be called with placeholders in
+// place of unknown values, as they copy their arguments to their result
+// without looking at them, along with the kind of placeholder each argument
+// can take. The last entry applies to any further arguments.
+//
+// An argument of cty.NilType is left unknown. One of cty.String only takes a
+// placeholder in place of an unknown string, while an unknown collection is
+// left unknown, as the function would look in to it. An empty tuple is the
+// shape of the placeholder for an unknown value of an unknown type, while an
+// unknown object in place of an empty one is replaced by an empty object, so
+// that the known keys of the other arguments are kept, and the result gets an
+// unresolvedKey entry with the source of the object. With typed unknowns, the
+// result is left unknown instead. cty.DynamicPseudoType takes a placeholder of any type. Values within
+// object and tuple constructors can always take placeholders. Functions that
+// aren't listed are called with unknown values, so that their result is
+// unknown.
+var placeholderArgs = map[string][]cty.Type{
+	"coalesce":   {cty.String},
+	"concat":     {cty.EmptyTuple},
+	"flatten":    {cty.EmptyTuple},
+	"format":     {cty.NilType, cty.String},
+	"join":       {cty.NilType, cty.String},
+	"jsonencode": {cty.DynamicPseudoType},
+	"lookup":     {cty.String, cty.NilType, cty.DynamicPseudoType},
+	"lower":      {cty.String},
+	"merge":      {cty.EmptyObject},
+	"title":      {cty.String},
+	"tolist":     {cty.DynamicPseudoType},
+	"tomap":      {cty.DynamicPseudoType},
+	"toset":      {cty.DynamicPseudoType},
+	"tostring":   {cty.String},
+	"trimspace":  {cty.String},
+	"upper":      {cty.String},
+}
+
+// unresolvedValue is an unknown value that a placeholder stands in for.
+type unresolvedValue struct {
+	source     string
+	value      cty.Value
+	references []string
+}
+
+// unresolvedValues tracks the placeholders that stand in for unknown values
+// while a function is called. When typed is set, unknown values are
+// converted to the typed representation of unknownValue rather than to
+// markers, and references are those of the expression that's converted.
+type unresolvedValues struct {
+	values     []unresolvedValue
+	typed      bool
+	references []string
+	// nonce tells the placeholders apart from any other text that looks
+	// like them
+	nonce string
+}
+
+// placeholder returns a string that stands in for an unknown value.
+func (u *unresolvedValues) placeholder(v unresolvedValue) string {
+	if u.nonce == "" {
+		u.nonce = fmt.Sprintf("%012d", rand.Int64N(1e12))
+	}
+	u.values = append(u.values, v)
+	return placeholderStart + u.nonce + strconv.Itoa(len(u.values)-1) + placeholderEnd
+}
+
+// placeholderValue returns a known value of roughly the given type that
+// stands in for an unknown value. Numbers and booleans can't hold a
+// placeholder, so they're left unknown.
+func (u *unresolvedValues) placeholderValue(v unresolvedValue, ty cty.Type) cty.Value {
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		return cty.ObjectVal(map[string]cty.Value{unresolvedKey: cty.StringVal(u.placeholder(v))})
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		return cty.TupleVal([]cty.Value{cty.StringVal(u.placeholder(v))})
+	case ty == cty.Number || ty == cty.Bool:
+		return v.value
+	default:
+		return cty.StringVal(u.placeholder(v))
+	}
+}
+
+// fill replaces the unknown parts of val, which came from source, with the
+// placeholders that the kind of argument allows, as described by
+// placeholderArgs.
+func (u *unresolvedValues) fill(val cty.Value, source string, refs []string, kind cty.Type) cty.Value {
+	if kind == cty.NilType || val.IsWhollyKnown() {
+		return val
+	}
+	if val.IsMarked() {
+		unmarked, marks := val.Unmark()
+		return u.fill(unmarked, source, refs, kind).WithMarks(marks)
+	}
+
+	ty := val.Type()
+	if !val.IsKnown() {
+		switch {
+		case kind.Equals(cty.EmptyObject):
+			return val
+		case ty == cty.DynamicPseudoType:
+			ty = kind
+		case kind.IsPrimitiveType() && !ty.IsPrimitiveType():
+			return val
+		}
+		return u.placeholderValue(unresolvedValue{source: source, value: val, references: refs}, ty)
+	}
+
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		attrs := make(map[string]cty.Value)
+		for key, item := range val.AsValueMap() {
+			attrs[key] = u.fill(item, attributeSource(source, key), refs, cty.DynamicPseudoType)
+		}
+		return cty.ObjectVal(attrs)
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		elems := make([]cty.Value, 0, val.LengthInt())
+		for i, item := range val.AsValueSlice() {
+			elems = append(elems, u.fill(item, fmt.Sprintf("%s[%d]", source, i), refs, cty.DynamicPseudoType))
+		}
+		return cty.TupleVal(elems)
+	}
+	return val
+}
+
+// native converts a value that may be partially unknown, such as the result
+// of a function call, to a value that can be converted to JSON. Placeholders
+// are turned back in to the source of the value they stand in for:
+// {"__unresolved__": "var.name"} in place of a whole value or a JSON string,
+// or "${var.name}" within a string. Any other unknown value is replaced by a
+// marker with the source of val and the path to the value.
+//
+// With typed unknowns, each unknown value is replaced by its unknownValue
+// instead, and a string with placeholders in it is an unknown string with
+// the known text before the first placeholder as its prefix.
+func (u *unresolvedValues) native(val cty.Value, source string) any {
+	if val.HasMark(funcs.MarkedSensitive) {
+		return "(sensitive value)"
+	}
+	val, _ = val.Unmark()
+	if !val.IsKnown() {
+		if u.typed {
+			return unknownValue(val, source, u.references)
+		}
+		return map[string]any{unresolvedKey: source}
+	}
+	if val.IsNull() {
+		return nil
+	}
+
+	ty := val.Type()
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		if item, ok := val.AsValueMap()[unresolvedKey]; ok && val.LengthInt() == 1 && item.Type() == cty.String && item.IsKnown() && !item.IsNull() {
+			// the placeholder of a whole unknown object
+			if v, ok := u.lookup(item.AsString()); ok {
+				if u.typed {
+					return unknownValue(v.value, v.source, v.references)
+				}
+				return map[string]any{unresolvedKey: v.source}
+			}
+		}
+		obj := make(map[string]any)
+		for key, item := range val.AsValueMap() {
+			obj[key] = u.native(item, attributeSource(source, key))
+		}
+		return obj
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		if val.LengthInt() == 1 {
+			// the placeholder of a whole unknown list
+			if item := val.AsValueSlice()[0]; item.Type() == cty.String && item.IsKnown() && !item.IsNull() {
+				if v, ok := u.lookupList(item.AsString()); ok {
+					if u.typed {
+						return unknownValue(v.value, v.source, v.references)
+					}
+					return map[string]any{unresolvedKey: v.source}
+				}
+			}
+		}
+		items := make([]any, 0, val.LengthInt())
+		for i, item := range val.AsValueSlice() {
+			items = append(items, u.native(item, fmt.Sprintf("%s[%d]", source, i)))
+		}
+		return items
+	case ty == cty.String:
+		str := val.AsString()
+		if v, ok := u.lookup(str); ok {
+			if u.typed {
+				return unknownValue(v.value, v.source, v.references)
+			}
+			return map[string]any{unresolvedKey: v.source}
+		}
+		if u.typed {
+			for _, loc := range placeholderPattern.FindAllStringIndex(str, -1) {
+				v, ok := u.lookup(str[loc[0]:loc[1]])
+				if !ok {
+					continue
+				}
+				prefix := str[:loc[0]]
+				if v.value.Type() != cty.String {
+					// a value of another type may not be encoded as a
+					// JSON string by jsonencode
+					prefix = strings.TrimSuffix(prefix, `"`)
+				}
+				unknown := cty.UnknownVal(cty.String).Refine().NotNull()
+				if prefix != "" {
+					unknown = unknown.StringPrefix(prefix)
+				}
+				return unknownValue(unknown.NewValue(), source, u.references)
+			}
+			return str
+		}
+		str = jsonListPlaceholderPattern.ReplaceAllStringFunc(str, func(match string) string {
+			v, ok := u.lookupList(jsonListPlaceholderPattern.FindStringSubmatch(match)[1])
+			if !ok {
+				return match
+			}
+			marker, _ := json.Marshal(map[string]string{unresolvedKey: v.source})
+			return string(marker)
+		})
+		str = jsonPlaceholderPattern.ReplaceAllStringFunc(str, func(match string) string {
+			groups := jsonPlaceholderPattern.FindStringSubmatch(match)
+			v, ok := u.lookup(groups[2])
+			if !ok {
+				return match
+			}
+			marker, _ := json.Marshal(map[string]string{unresolvedKey: v.source})
+			if groups[1] != "" && groups[3] != "" {
+				return string(marker)
+			}
+			return groups[1] + string(marker) + groups[3]
+		})
+		return placeholderPattern.ReplaceAllStringFunc(str, func(placeholder string) string {
+			v, ok := u.lookup(placeholder)
+			if !ok {
+				return placeholder
+			}
+			return fmt.Sprintf("${%s}", v.source)
+		})
+	}
+
+	raw, _ := convertCtyToNativeValue(val)
+	return raw
+}
+
+// lookup returns the unknown value that a placeholder stands in for, if str
+// is a placeholder.
+func (u *unresolvedValues) lookup(str string) (unresolvedValue, bool) {
+	match := placeholderPattern.FindStringSubmatch(str)
+	if match == nil || match[0] != str || match[1] != u.nonce {
+		return unresolvedValue{}, false
+	}
+	i, err := strconv.Atoi(match[2])
+	if err != nil || i >= len(u.values) {
+		return unresolvedValue{}, false
+	}
+	return u.values[i], true
+}
+
+// lookupList returns the unknown value that a placeholder stands in for, if
+// str is the placeholder of a whole list, rather than of one of its elements.
+func (u *unresolvedValues) lookupList(str string) (unresolvedValue, bool) {
+	v, ok := u.lookup(str)
+	if ty := v.value.Type(); !ok || !(ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+		return unresolvedValue{}, false
+	}
+	return v, true
+}
+
+// unknownValue returns the typed representation of an unknown value: its
+// type, the source of the expression it came from as it's written and as
+// it's formatted by hclwrite, the references of that expression, and what's
+// known of the value from its refinements, such as
+//
+//	{"__unknown__": true, "type": "string", "source": "aws_s3_bucket.logs.arn",
+//	 "formatted": "aws_s3_bucket.logs.arn",
+//	 "references": ["aws_s3_bucket.logs.arn"],
+//	 "refinements": {"not_null": true, "prefix": "arn:"}}
+func unknownValue(val cty.Value, source string, refs []string) map[string]any {
+	val, _ = val.UnmarkDeep()
+	obj := map[string]any{
+		unknownKey: true,
+		"type":     typeexpr.TypeString(val.Type()),
+		"source":   source,
+	}
+	if formatted, ok := formatExpression(source); ok {
+		obj["formatted"] = formatted
+	}
+	if len(refs) > 0 {
+		obj["references"] = refs
+	}
+
+	rng := val.Range()
+	refinements := map[string]any{}
+	if rng.DefinitelyNotNull() {
+		refinements["not_null"] = true
+	}
+	ty := val.Type()
+	if ty == cty.String {
+		if prefix := rng.StringPrefix(); prefix != "" {
+			refinements["prefix"] = prefix
+		}
+	}
+	if ty.IsCollectionType() {
+		if minLen := rng.LengthLowerBound(); minLen > 0 {
+			refinements["length_min"] = minLen
+		}
+		if maxLen := rng.LengthUpperBound(); maxLen != math.MaxInt {
+			refinements["length_max"] = maxLen
+		}
+	}
+	if len(refinements) > 0 {
+		obj["refinements"] = refinements
+	}
+	return obj
+}
+
+// expressionReferences returns the references of an expression, such as
+// "data.aws_caller_identity.current.account_id", sorted and without
+// duplicates.
+func (t *terraformConverter) expressionReferences(expr hcl.Expression) []string {
+	refs := stringSet{}
+	for _, traversal := range expr.Variables() {
+		refs.Add(t.traversalPath(traversal))
+	}
+	entries := refs.Entries()
+	slices.Sort(entries)
+	return entries
+}
+
+// attributeSource returns the source of an attribute of the value of source.
+func attributeSource(source, key string) string {
+	if hclsyntax.ValidIdentifier(key) {
+		return fmt.Sprintf("%s.%s", source, key)
+	}
+	return fmt.Sprintf("%s[%q]", source, key)
+}
+
+// formatExpression formats the source of an expression the way terraform fmt
+// would, such as `var.env == "prod" ? 3 : 1` for `var.env=="prod"?3:1`. It
+// returns false if source isn't a valid expression, such as the range of an
+// expression in a file that couldn't be read.
+func formatExpression(source string) (string, bool) {
+	if _, diags := hclsyntax.ParseExpression([]byte(source), "", hcl.InitialPos); diags.HasErrors() {
+		return "", false
+	}
+	return string(hclwrite.Format([]byte(source))), true
+}
+
+// callPartially calls a function with the values of its arguments, where the
+// unknown parts of the arguments are replaced by placeholders, as far as the
+// function allows, so that the result is known apart from the placeholders.
+func (t *terraformConverter) callPartially(call *hclsyntax.FunctionCallExpr, functions map[string]function.Function, ctx *hcl.EvalContext, u *unresolvedValues) (cty.Value, bool) {
+	fn, ok := functions[call.Name]
+	if !ok {
+		return cty.NilVal, false
+	}
+
+	kinds := placeholderArgs[call.Name]
+	args := make([]cty.Value, 0, len(call.Args))
+	var omitted []string
+	for i, arg := range call.Args {
+		kind := cty.NilType
+		if len(kinds) > 0 {
+			kind = kinds[min(i, len(kinds)-1)]
+		}
+		if call.ExpandFinal && i == len(call.Args)-1 {
+			// the elements of an expanded argument are arguments themselves
+			kind = cty.NilType
+		}
+		val := t.partialValue(arg, functions, ctx, u, kind)
+		if kind.Equals(cty.EmptyObject) && !val.IsKnown() {
+			if u.typed {
+				return cty.NilVal, false
+			}
+			// the keys of an unknown object aren't known, so it's left out
+			val = cty.EmptyObjectVal
+			omitted = append(omitted, t.expressionSource(arg))
+		}
+		args = append(args, val)
+	}
+
+	if call.ExpandFinal && len(args) > 0 {
+		last := args[len(args)-1]
+		if !last.IsWhollyKnown() || last.IsNull() || !last.CanIterateElements() {
+			return cty.NilVal, false
+		}
+		args = append(args[:len(args)-1], last.AsValueSlice()...)
+	}
+
+	result, err := fn.Call(args)
+	if err != nil {
+		t.logger.Debug("unable to call function with partial arguments", "name", call.Name, "error", err)
+		return cty.NilVal, false
+	}
+	if len(omitted) == 0 {
+		return result, true
+	}
+	if !result.IsKnown() || result.IsNull() || !(result.Type().IsObjectType() || result.Type().IsMapType()) || result.LengthInt() == 0 {
+		// nothing is known of a result that only had unknown objects in it
+		return cty.NilVal, false
+	}
+	// the result is marked as missing the keys of the objects left out
+	attrs := result.AsValueMap()
+	attrs[unresolvedKey] = cty.StringVal(strings.Join(omitted, ", "))
+	return cty.ObjectVal(attrs), true
+}
+
+// partialValue evaluates an expression, and replaces any part of its value
+// that isn't known with the placeholders that the kind of argument allows.
+// Object and tuple constructors, templates and function calls are evaluated
+// part by part, so that their known parts are kept.
+func (t *terraformConverter) partialValue(expr hcl.Expression, functions map[string]function.Function, ctx *hcl.EvalContext, u *unresolvedValues, kind cty.Type) cty.Value {
+	val, diags := expr.Value(ctx)
+	if !diags.HasErrors() && val.IsWhollyKnown() {
+		return val
+	}
+	if kind == cty.NilType {
+		if diags.HasErrors() {
+			return cty.DynamicVal
+		}
+		return val
+	}
+	source := t.expressionSource(expr)
+	refs := t.expressionReferences(expr)
+
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		attrs := make(map[string]cty.Value)
+		for _, item := range e.Items {
+			key := t.extractKey(item.KeyExpr)
+			if keyVal, diags := item.KeyExpr.Value(ctx); !diags.HasErrors() {
+				if keyStr, err := convert.Convert(keyVal, cty.String); err == nil && keyStr.IsKnown() && !keyStr.IsNull() {
+					key = keyStr.AsString()
+				}
+			}
+			if key == "" {
+				continue
+			}
+			attrs[key] = t.partialValue(item.ValueExpr, functions, ctx, u, cty.DynamicPseudoType)
+		}
+		return cty.ObjectVal(attrs)
+
+	case *hclsyntax.TupleConsExpr:
+		elems := make([]cty.Value, 0, len(e.Exprs))
+		for _, elem := range e.Exprs {
+			elems = append(elems, t.partialValue(elem, functions, ctx, u, cty.DynamicPseudoType))
+		}
+		return cty.TupleVal(elems)
+
+	case *hclsyntax.TemplateWrapExpr:
+		return t.partialValue(e.Wrapped, functions, ctx, u, kind)
+
+	case *hclsyntax.TemplateExpr:
+		var str string
+		for _, part := range e.Parts {
+			partVal, err := convert.Convert(t.partialValue(part, functions, ctx, u, cty.String), cty.String)
+			if err != nil || !partVal.IsKnown() || partVal.IsNull() {
+				str += u.placeholder(unresolvedValue{
+					source:     t.expressionSource(part),
+					value:      cty.UnknownVal(cty.String),
+					references: t.expressionReferences(part),
+				})
+				continue
+			}
+			partVal, _ = partVal.Unmark()
+			str += partVal.AsString()
+		}
+		return cty.StringVal(str)
+
+	case *hclsyntax.FunctionCallExpr:
+		if result, ok := t.callPartially(e, functions, ctx, u); ok {
+			return u.fill(result, source, refs, kind)
+		}
+	}
+
+	if diags.HasErrors() {
+		val = cty.DynamicVal
+	}
+	return u.fill(val, source, refs, kind)
+}
+
+// oneOf returns the values of both branches of a conditional expression with
+// a condition that isn't known, along with the source of the condition.
+// Branches that are such conditionals themselves are nested.
+func (t *terraformConverter) oneOf(expr hcl.Expression, functions map[string]function.Function, ctx *hcl.EvalContext) (map[string]any, bool) {
+	for {
+		if paren, ok := expr.(*hclsyntax.ParenthesesExpr); ok {
+			expr = paren.Expression
+		} else if wrap, ok := expr.(*hclsyntax.TemplateWrapExpr); ok {
+			expr = wrap.Wrapped
+		} else {
+			break
+		}
+	}
+	cond, ok := expr.(*hclsyntax.ConditionalExpr)
+	if !ok {
+		return nil, false
+	}
+	// a condition that can't be evaluated may not be unknown at all
+	if condVal, diags := cond.Condition.Value(ctx); diags.HasErrors() || condVal.IsKnown() {
+		return nil, false
+	}
+
+	values := make([]any, 0, 2)
+	for _, branch := range []hcl.Expression{cond.TrueResult, cond.FalseResult} {
+		if nested, ok := t.oneOf(branch, functions, ctx); ok {
+			values = append(values, nested)
+			continue
+		}
+		u := &unresolvedValues{typed: t.typedUnknowns, references: t.expressionReferences(branch)}
+		val := t.partialValue(branch, functions, ctx, u, cty.DynamicPseudoType)
+		values = append(values, u.native(val, t.expressionSource(branch)))
+	}
+	return map[string]any{
+		oneOfKey:    values,
+		"condition": t.expressionSource(cond.Condition),
+	}, true
+}
+
+// expressionSource returns the source of an expression, as it's written in
+// its file, such as "data.aws_caller_identity.current.account_id".
+func (t *terraformConverter) expressionSource(expr hcl.Expression) string {
+	if src, ok := t.readSource(expr.Range()); ok {
+		return src
+	}
+
+	if traversal, ok := expr.(*hclsyntax.ScopeTraversalExpr); ok {
+		if path, err := getRootPath(traversal.Traversal); err == nil {
+			return path
+		}
+	}
+	return expr.Range().String()
+}
+
+// rangeSource returns the source text of a range, or a description of the
+// range if the source can't be read.
+func (t *terraformConverter) rangeSource(rng hcl.Range) string {
+	if src, ok := t.readSource(rng); ok {
+		return src
+	}
+	return rng.String()
+}
+
+// readSource returns the source text of a range, as it's written in its file.
+func (t *terraformConverter) readSource(rng hcl.Range) (string, bool) {
+	src, ok := t.sources[rng.Filename]
+	if !ok {
+		// files that can't be read, such as those of downloaded modules, are
+		// remembered as empty
+		src, _ = t.readFile(rng.Filename)
+		t.sources[rng.Filename] = src
+	}
+	if rng.Start.Byte < rng.End.Byte && rng.End.Byte <= len(src) {
+		return string(src[rng.Start.Byte:rng.End.Byte]), true
+	}
+	return "", false
+}
@@ -0,0 +1,315 @@
+// Copyright The Cloud Custodian Authors.
+// SPDX-License-Identifier: Apache-2.0
+package converter
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aquasecurity/trivy/pkg/iac/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The sources of the values of input variables, other than the paths of
+// variable files and the paths of the module blocks that set them.
+const (
+	variableSourceDefault = "default"
+	variableSourceEnv     = "env"
+	variableSourceVar     = "var"
+	variableSourceUnset   = "unset"
+)
+
+// variableArg is a variable file or value given with WithTFVarsPaths or
+// WithVariables. Like the -var-file and -var options of terraform plan, later
+// arguments take precedence over earlier ones.
+type variableArg struct {
+	file  string
+	name  string
+	value string
+}
+
+// variableDecl is what's needed of the declaration of a root module variable
+// to work out its value.
+type variableDecl struct {
+	typ        cty.Type
+	hasDefault bool
+}
+
+var (
+	variablesSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+	}
+	variableSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "type"}, {Name: "default"}},
+	}
+)
+
+// loadVariables works out the values of the root module's variables like
+// Terraform does: from the TF_VAR_ environment variables, then from the
+// variable files that are loaded automatically, then from the variable files
+// and values in the order they were given. Declared variables that are left
+// without a value or a default are unknown.
+func (t *terraformConverter) loadVariables(files map[string]*hcl.File, logger *slog.Logger) (map[string]cty.Value, error) {
+	decls := readVariableDecls(files)
+	vars := map[string]cty.Value{}
+
+	for _, env := range t.environ {
+		key, raw, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, "TF_VAR_")
+		if !ok {
+			continue
+		}
+		decl, ok := decls[name]
+		if !ok {
+			// Terraform ignores the environment variables of undeclared
+			// variables, as they may be meant for another module
+			continue
+		}
+		val, err := parseVariableValue(name, raw, decl.typ)
+		if err != nil {
+			return nil, err
+		}
+		vars[name] = val
+		t.variableSources[name] = variableSourceEnv
+	}
+
+	args := t.variableArgs
+	if t.autoLoadTFVars {
+		auto, err := t.autoLoadedVariableFiles()
+		if err != nil {
+			return nil, err
+		}
+		args = append(auto, args...)
+	}
+
+	for _, arg := range args {
+		if arg.file != "" {
+			fileVars, err := t.loadVariablesFile(arg.file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load tfvars from %s: %w", arg.file, err)
+			}
+			maps.Copy(vars, fileVars)
+			for name := range fileVars {
+				t.variableSources[name] = arg.file
+			}
+			t.variableFiles = append(t.variableFiles, arg.file)
+			continue
+		}
+		decl, ok := decls[arg.name]
+		if !ok {
+			// like terraform plan, values of undeclared variables are an error
+			return nil, fmt.Errorf("value for undeclared variable %q", arg.name)
+		}
+		val, err := parseVariableValue(arg.name, arg.value, decl.typ)
+		if err != nil {
+			return nil, err
+		}
+		vars[arg.name] = val
+		t.variableSources[arg.name] = variableSourceVar
+	}
+
+	var missing []string
+	for _, name := range slices.Sorted(maps.Keys(decls)) {
+		decl := decls[name]
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if decl.hasDefault {
+			// the parser uses the default in place of a value without a
+			// type, and only reads TF_VAR_ variables from the process
+			// environment itself if it isn't given any values
+			vars[name] = cty.NilVal
+			continue
+		}
+		// unknown values still allow expressions using them to be evaluated
+		// to something other than null
+		if decl.typ != cty.NilType {
+			vars[name] = cty.UnknownVal(decl.typ)
+		} else {
+			vars[name] = cty.DynamicVal
+		}
+		t.variableSources[name] = variableSourceUnset
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		logger.Warn(
+			"Variable values were not found in the environment or variable files. Evaluating may not work correctly.",
+			slog.String("variables", strings.Join(missing, ", ")),
+		)
+	}
+
+	return vars, nil
+}
+
+// getVariableValue returns the value of an input variable as it's used by
+// the rest of its module, along with where the value came from.
+func (t *terraformConverter) getVariableValue(b *terraform.Block) (cty.Value, string) {
+	name := b.Label()
+
+	source := variableSourceUnset
+	if moduleBlock := t.getModuleBlock(b); moduleBlock != nil {
+		if moduleBlock.GetAttribute(name) != nil {
+			source = t.getPath(moduleBlock, t.getModuleName(moduleBlock))
+		} else if b.GetAttribute("default") != nil {
+			source = variableSourceDefault
+		}
+	} else if s, ok := t.variableSources[name]; ok {
+		source = s
+	} else if b.GetAttribute("default") != nil {
+		source = variableSourceDefault
+	}
+
+	if b.Context() == nil {
+		return cty.NilVal, source
+	}
+	// defaults that were worked out again with overrides take precedence
+	vars := lookupVariable(b.Context().Inner(), "var")
+	layers := t.getModuleOverrides(b)
+	for i := len(layers) - 1; i >= 0; i-- {
+		if layerVars, ok := layers[i].vars["var"]; ok {
+			vars = layerVars
+			break
+		}
+	}
+	if vars == cty.NilVal || !vars.Type().IsObjectType() || !vars.Type().HasAttribute(name) {
+		return cty.NilVal, source
+	}
+	return vars.GetAttr(name), source
+}
+
+// autoLoadedVariableFiles returns the variable files that Terraform loads
+// from the root module without being given them: terraform.tfvars, then
+// terraform.tfvars.json, then any *.auto.tfvars and *.auto.tfvars.json files
+// in lexical order.
+func (t *terraformConverter) autoLoadedVariableFiles() ([]variableArg, error) {
+	entries, err := fs.ReadDir(t.fileSystem, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var files, autoFiles []variableArg
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		switch {
+		case name == "terraform.tfvars", name == "terraform.tfvars.json":
+			files = append(files, variableArg{file: name})
+		case strings.HasSuffix(name, ".auto.tfvars"), strings.HasSuffix(name, ".auto.tfvars.json"):
+			autoFiles = append(autoFiles, variableArg{file: name})
+		}
+	}
+	// directory entries are sorted by name, so terraform.tfvars comes before
+	// terraform.tfvars.json
+	return append(files, autoFiles...), nil
+}
+
+// loadVariablesFile reads the values of a .tfvars or .tfvars.json file.
+// Values that can't be evaluated are left dynamic, like the parser does.
+func (t *terraformConverter) loadVariablesFile(filename string) (map[string]cty.Value, error) {
+	src, err := t.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(filename, ".json") {
+		file, diags = hcljson.Parse(src, filename)
+	} else {
+		file, diags = hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	vars := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		vars[name], _ = attr.Expr.Value(&hcl.EvalContext{})
+	}
+	return vars, nil
+}
+
+// readVariableDecls reads the variable declarations of the root module from
+// its parsed files.
+func readVariableDecls(files map[string]*hcl.File) map[string]variableDecl {
+	decls := map[string]variableDecl{}
+	for _, filename := range slices.Sorted(maps.Keys(files)) {
+		content, _, _ := files[filename].Body.PartialContent(variablesSchema)
+		if content == nil {
+			continue
+		}
+		for _, block := range content.Blocks {
+			attrs, _, _ := block.Body.PartialContent(variableSchema)
+			if attrs == nil {
+				continue
+			}
+			decl := variableDecl{typ: cty.NilType}
+			if attr, ok := attrs.Attributes["type"]; ok {
+				decl.typ = variableType(attr.Expr)
+			}
+			_, decl.hasDefault = attrs.Attributes["default"]
+			decls[block.Labels[0]] = decl
+		}
+	}
+	return decls
+}
+
+// variableType decodes the type constraint of a variable the same way as the
+// parser, including the list and map shorthands and quoted types of Terraform
+// 0.11. It returns cty.NilType if the type isn't valid.
+func variableType(expr hcl.Expression) cty.Type {
+	switch hcl.ExprAsKeyword(expr) {
+	case "list":
+		return cty.List(cty.DynamicPseudoType)
+	case "map":
+		return cty.Map(cty.DynamicPseudoType)
+	}
+
+	if ty, _, diags := typeexpr.TypeConstraintWithDefaults(expr); !diags.HasErrors() {
+		return ty
+	}
+
+	val, diags := expr.Value(&hcl.EvalContext{})
+	if diags.HasErrors() || val.Type() != cty.String || !val.IsKnown() || val.IsNull() {
+		return cty.NilType
+	}
+	unquoted, diags := hclsyntax.ParseExpression([]byte(val.AsString()), "", expr.Range().Start)
+	if diags.HasErrors() {
+		return cty.NilType
+	}
+	return variableType(unquoted)
+}
+
+// parseVariableValue parses the value of a variable given as a string, in an
+// environment variable or with WithVariables. Like Terraform, values of
+// variables with a primitive type, or without a type, are taken literally,
+// while others are parsed as HCL expressions such as ["a", "b"].
+func parseVariableValue(name, raw string, ty cty.Type) (cty.Value, error) {
+	if ty == cty.NilType || ty.IsPrimitiveType() {
+		return cty.StringVal(raw), nil
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(raw), fmt.Sprintf("<value for var.%s>", name), hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("invalid value for variable %q: %w", name, diags)
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("invalid value for variable %q: %w", name, diags)
+	}
+	return val, nil
+}
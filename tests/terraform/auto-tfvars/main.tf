@@ -0,0 +1,34 @@
+variable "a" {
+  type    = string
+  default = "default"
+}
+
+variable "b" {
+  type    = string
+  default = "default"
+}
+
+variable "c" {
+  type    = string
+  default = "default"
+}
+
+variable "d" {
+  type    = string
+  default = "default"
+}
+
+variable "e" {
+  type    = string
+  default = "default"
+}
+
+output "values" {
+  value = {
+    a = var.a
+    b = var.b
+    c = var.c
+    d = var.d
+    e = var.e
+  }
+}
@@ -0,0 +1,41 @@
+resource "aws_instance" "web" {
+  ami           = "ami-12345678"
+  instance_type = "t3.micro"
+}
+
+import {
+  to = aws_instance.web
+  id = "i-0123456789abcdef0"
+}
+
+removed {
+  from = aws_instance.legacy
+
+  lifecycle {
+    destroy = false
+  }
+}
+
+check "health_check" {
+  data "http" "site" {
+    url = "https://example.com"
+  }
+
+  assert {
+    condition     = data.http.site.status_code == 200
+    error_message = "site returned an unhealthy status code"
+  }
+}
+
+ephemeral "aws_secretsmanager_secret_version" "db_password" {
+  secret_id = "db-password"
+}
+
+output "instance_id" {
+  value = aws_instance.web.id
+}
+
+output "db_password" {
+  value     = ephemeral.aws_secretsmanager_secret_version.db_password.secret_string
+  sensitive = true
+}
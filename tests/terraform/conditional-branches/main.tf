@@ -0,0 +1,27 @@
+variable "encrypted" {
+  type = bool
+}
+
+variable "env" {
+  type = string
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "logs" {
+  bucket = "logs"
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm     = var.encrypted ? "aws:kms" : "AES256"
+      kms_master_key_id = var.encrypted ? "arn:aws:kms:us-east-1:${data.aws_caller_identity.current.account_id}:alias/logs" : null
+    }
+  }
+}
+
+resource "aws_instance" "web" {
+  ami           = "ami-123"
+  instance_type = var.env == "prod" ? "m5.large" : (var.env == "staging" ? "t3.large" : "t3.micro")
+  monitoring    = var.encrypted && var.env == "prod"
+  ebs_optimized = local.missing ? true : false
+}
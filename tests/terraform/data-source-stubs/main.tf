@@ -0,0 +1,34 @@
+data "aws_caller_identity" "current" {}
+
+data "aws_region" "current" {}
+
+data "aws_partition" "current" {}
+
+data "google_project" "current" {}
+
+locals {
+  account_id = data.aws_caller_identity.current.account_id
+  role_arn   = "arn:${data.aws_partition.current.partition}:iam::${local.account_id}:role/deploy"
+}
+
+variable "tags" {
+  type = map(string)
+  default = {
+    Region = data.aws_region.current.name
+  }
+}
+
+resource "aws_iam_role" "deploy" {
+  name                 = "deploy"
+  permissions_boundary = "arn:${data.aws_partition.current.partition}:iam::${local.account_id}:policy/boundary"
+  tags                 = merge(var.tags, { Role = local.role_arn })
+}
+
+resource "google_storage_bucket" "logs" {
+  name    = "${data.google_project.current.project_id}-logs"
+  project = data.google_project.current.project_id
+}
+
+module "tags" {
+  source = "./modules/tags"
+}
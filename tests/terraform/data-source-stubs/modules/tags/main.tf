@@ -0,0 +1,7 @@
+data "aws_caller_identity" "current" {}
+
+resource "aws_instance" "tagged" {
+  tags = {
+    Owner = data.aws_caller_identity.current.account_id
+  }
+}
@@ -0,0 +1,11 @@
+variable "environment" {
+  type = string
+}
+
+resource "aws_s3_bucket" "example" {
+  bucket = "example-${var.environment}"
+}
+
+module "missing" {
+  source = "./modules/missing"
+}
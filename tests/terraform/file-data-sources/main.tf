@@ -0,0 +1,62 @@
+data "archive_file" "dir" {
+  type             = "zip"
+  source_dir       = "${path.module}/src"
+  excludes         = ["tests"]
+  output_path      = "${path.module}/build/dir.zip"
+  output_file_mode = "0666"
+}
+
+data "archive_file" "file" {
+  type             = "zip"
+  source_file      = "${path.module}/src/handler.py"
+  output_path      = "${path.module}/build/file.zip"
+  output_file_mode = "0666"
+}
+
+data "archive_file" "content" {
+  type                    = "zip"
+  source_content          = "print('hello')\n"
+  source_content_filename = "hello.py"
+  output_path             = "${path.module}/build/content.zip"
+}
+
+data "archive_file" "sources" {
+  type        = "zip"
+  output_path = "${path.module}/build/sources.zip"
+
+  source {
+    content  = "b"
+    filename = "b.txt"
+  }
+
+  source {
+    content  = "a"
+    filename = "a.txt"
+  }
+}
+
+data "local_sensitive_file" "secret" {
+  filename = "${path.module}/secret.txt"
+}
+
+resource "aws_lambda_function" "dir" {
+  function_name    = "dir"
+  filename         = data.archive_file.dir.output_path
+  source_code_hash = data.archive_file.dir.output_base64sha256
+}
+
+resource "aws_lambda_function" "file" {
+  function_name    = "file"
+  filename         = data.archive_file.file.output_path
+  source_code_hash = data.archive_file.file.output_base64sha256
+}
+
+resource "aws_ssm_parameter" "secret" {
+  name  = "secret"
+  type  = "SecureString"
+  value = data.local_sensitive_file.secret.content
+}
+
+module "config" {
+  source = "./modules/config"
+}
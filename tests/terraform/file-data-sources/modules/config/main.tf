@@ -0,0 +1,17 @@
+data "local_file" "config" {
+  filename = "${path.module}/config.json"
+}
+
+locals {
+  config = jsondecode(data.local_file.config.content)
+}
+
+resource "aws_s3_object" "config" {
+  bucket  = "example"
+  key     = "config.json"
+  content = data.local_file.config.content
+  etag    = data.local_file.config.content_md5
+  tags = {
+    Environment = local.config.environment
+  }
+}
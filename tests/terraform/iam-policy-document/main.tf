@@ -0,0 +1,103 @@
+data "aws_caller_identity" "current" {}
+
+locals {
+  bucket_arn = "arn:aws:s3:::example-bucket"
+}
+
+data "aws_iam_policy_document" "base" {
+  statement {
+    sid       = "ReadBucket"
+    actions   = ["s3:ListBucket", "s3:GetObject"]
+    resources = [local.bucket_arn, "${local.bucket_arn}/*"]
+  }
+
+  statement {
+    sid       = "HomeDirectory"
+    actions   = ["s3:PutObject"]
+    resources = ["${local.bucket_arn}/home/&{aws:username}/*"]
+  }
+}
+
+data "aws_iam_policy_document" "combined" {
+  source_policy_documents   = [data.aws_iam_policy_document.base.json]
+  override_policy_documents = [data.aws_iam_policy_document.deny_delete.json]
+
+  statement {
+    sid       = "HomeDirectory"
+    actions   = ["s3:PutObject", "s3:DeleteObject"]
+    resources = ["${local.bucket_arn}/home/*"]
+  }
+
+  statement {
+    effect      = "Deny"
+    not_actions = ["s3:*"]
+    resources   = ["*"]
+
+    condition {
+      test     = "Bool"
+      variable = "aws:SecureTransport"
+      values   = ["false"]
+    }
+  }
+}
+
+data "aws_iam_policy_document" "deny_delete" {
+  statement {
+    sid       = "ReadBucket"
+    effect    = "Deny"
+    actions   = ["s3:DeleteBucket"]
+    resources = [local.bucket_arn]
+  }
+}
+
+data "aws_iam_policy_document" "assume_role" {
+  statement {
+    actions = ["sts:AssumeRole"]
+
+    principals {
+      type        = "Service"
+      identifiers = ["lambda.amazonaws.com"]
+    }
+
+    principals {
+      type        = "AWS"
+      identifiers = ["arn:aws:iam::123456789012:root", "arn:aws:iam::210987654321:root"]
+    }
+
+    condition {
+      test     = "StringEquals"
+      variable = "sts:ExternalId"
+      values   = ["example"]
+    }
+  }
+}
+
+data "aws_iam_policy_document" "public" {
+  dynamic "statement" {
+    for_each = ["s3:GetObject", "s3:GetObjectVersion"]
+    content {
+      actions   = [statement.value]
+      resources = ["${local.bucket_arn}/*"]
+
+      principals {
+        type        = "*"
+        identifiers = ["*"]
+      }
+    }
+  }
+}
+
+resource "aws_iam_policy" "combined" {
+  name   = "combined"
+  policy = data.aws_iam_policy_document.combined.json
+}
+
+resource "aws_iam_role" "lambda" {
+  name               = "lambda"
+  assume_role_policy = data.aws_iam_policy_document.assume_role.json
+}
+
+resource "aws_s3_bucket_policy" "public" {
+  bucket = "example-bucket"
+  policy = data.aws_iam_policy_document.public.minified_json
+}
@@ -0,0 +1,22 @@
+resource "aws_s3_bucket" "logs" {
+  bucket = "access-logs"
+}
+
+module "bucket" {
+  source         = "./modules/bucket"
+  bucket_name    = "module-bucket"
+  logging_bucket = aws_s3_bucket.logs.id
+}
+
+resource "aws_s3_bucket_policy" "outside_module" {
+  bucket = module.bucket.id
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Deny"
+      Principal = "*"
+      Action    = "s3:*"
+      Resource  = "${module.bucket.arn}/*"
+    }]
+  })
+}
@@ -0,0 +1,37 @@
+variable "bucket_name" {
+  type = string
+}
+
+variable "logging_bucket" {
+  type = string
+}
+
+resource "aws_s3_bucket" "this" {
+  bucket = var.bucket_name
+}
+
+resource "aws_s3_bucket_versioning" "this" {
+  bucket = aws_s3_bucket.this.id
+
+  versioning_configuration {
+    status = "Enabled"
+  }
+}
+
+resource "aws_s3_bucket_logging" "this" {
+  bucket        = aws_s3_bucket.this.id
+  target_bucket = var.logging_bucket
+  target_prefix = "log/"
+}
+
+locals {
+  bucket_id = aws_s3_bucket.this.id
+}
+
+output "id" {
+  value = local.bucket_id
+}
+
+output "arn" {
+  value = aws_s3_bucket.this.arn
+}
@@ -0,0 +1,10 @@
+module "first" {
+  source = "./modules/first"
+}
+
+module "second" {
+  source = "./modules/second"
+  tags = {
+    Team = "second"
+  }
+}
@@ -0,0 +1,24 @@
+variable "tags" {
+  type = map(string)
+  default = {
+    Team = "first"
+  }
+}
+
+locals {
+  extra = {
+    Module = "first"
+  }
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_s3_bucket" "this" {
+  bucket = "first"
+  tags = merge(var.tags, {
+    Owner = data.aws_caller_identity.current.account_id
+  })
+  tags_all = merge(local.extra, {
+    Owner = data.aws_caller_identity.current.account_id
+  })
+}
@@ -0,0 +1,21 @@
+variable "tags" {
+  type = map(string)
+}
+
+locals {
+  extra = {
+    Module = "second"
+  }
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_s3_bucket" "this" {
+  bucket = "second"
+  tags = merge(var.tags, {
+    Owner = data.aws_caller_identity.current.account_id
+  })
+  tags_all = merge(local.extra, {
+    Owner = data.aws_caller_identity.current.account_id
+  })
+}
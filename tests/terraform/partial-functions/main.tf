@@ -0,0 +1,65 @@
+variable "tags" {
+  type = map(string)
+  default = {
+    Team = "platform"
+  }
+}
+
+variable "subnet_ids" {
+  type = list(string)
+}
+
+variable "ami" {
+  type = string
+}
+
+variable "principal_arn" {
+  type = string
+}
+
+variable "amis" {
+  type = map(string)
+}
+
+data "aws_caller_identity" "current" {}
+
+data "aws_region" "current" {}
+
+locals {
+  names = {
+    prod = "production"
+  }
+}
+
+resource "aws_s3_bucket" "merged" {
+  bucket = format("logs-%s-%s", data.aws_caller_identity.current.account_id, "archive")
+  tags = merge(var.tags, {
+    Owner  = data.aws_caller_identity.current.account_id
+    Region = "${data.aws_region.current.name}-primary"
+  })
+}
+
+resource "aws_instance" "concat" {
+  ami                    = coalesce(var.ami, "ami-12345678")
+  vpc_security_group_ids = concat(["sg-12345678"], var.subnet_ids, [upper("sg-abcdef")])
+  tags = merge({
+    Environment = lookup(local.names, "prod", "unknown")
+    Image       = lookup(var.amis, "prod", "ami-default")
+    Mode        = lower(length(var.subnet_ids) > 1 ? "MULTI" : "SINGLE")
+  }, var.tags)
+}
+
+resource "aws_iam_policy" "encoded" {
+  name = "encoded"
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect   = "Allow"
+      Action   = ["s3:GetObject"]
+      Resource = "arn:aws:s3:::${aws_s3_bucket.merged.bucket}/*"
+      Principal = {
+        AWS = var.principal_arn
+      }
+    }]
+  })
+}
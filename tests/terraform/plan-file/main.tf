@@ -0,0 +1,61 @@
+data "aws_caller_identity" "current" {}
+
+data "aws_iam_policy" "boundary" {
+  name = "boundary-${data.aws_caller_identity.current.account_id}"
+}
+
+resource "aws_iam_role" "web" {
+  name                 = "web"
+  permissions_boundary = data.aws_iam_policy.boundary.arn
+}
+
+resource "aws_subnet" "main" {
+  vpc_id     = "vpc-12345678"
+  cidr_block = "10.0.1.0/24"
+}
+
+resource "aws_instance" "web" {
+  count         = 2
+  ami           = "ami-12345678"
+  instance_type = "t3.micro"
+  subnet_id     = aws_subnet.main.id
+}
+
+module "bucket" {
+  source = "./modules/bucket"
+  prefix = data.aws_caller_identity.current.account_id
+}
+
+# the plan is older than the configuration, so only the values that aren't
+# known from configuration are taken from it
+resource "aws_security_group" "web" {
+  name   = "web"
+  vpc_id = aws_subnet.main.vpc_id
+
+  tags = {
+    Name    = "web"
+    Account = data.aws_caller_identity.current.account_id
+    Subnet  = aws_subnet.main.id
+  }
+}
+
+# nested blocks that are sets, such as ingress, are matched to the ones in
+# the plan by the values that are known from configuration
+resource "aws_security_group" "db" {
+  name = "db"
+
+  ingress {
+    description = "postgres from ${data.aws_caller_identity.current.account_id}"
+    from_port   = 5432
+    to_port     = 5432
+    protocol    = "tcp"
+  }
+
+  ingress {
+    description     = "ssh"
+    from_port       = 22
+    to_port         = 22
+    protocol        = "tcp"
+    security_groups = [aws_security_group.web.id]
+  }
+}
@@ -0,0 +1,7 @@
+variable "prefix" {
+  type = string
+}
+
+resource "aws_s3_bucket" "this" {
+  bucket = "${var.prefix}-logs"
+}
@@ -0,0 +1,73 @@
+data "terraform_remote_state" "network" {
+  backend = "s3"
+
+  config = {
+    bucket = "example-terraform-state"
+    key    = "network/terraform.tfstate"
+    region = "us-east-1"
+  }
+}
+
+data "terraform_remote_state" "app" {
+  backend = "remote"
+
+  config = {
+    organization = "c7n"
+    workspaces = {
+      name = "testing"
+    }
+  }
+}
+
+data "terraform_remote_state" "prefixed" {
+  backend   = "remote"
+  workspace = "production"
+
+  config = {
+    organization = "c7n"
+    workspaces = {
+      prefix = ""
+    }
+  }
+}
+
+data "terraform_remote_state" "local" {
+  backend = "local"
+
+  config = {
+    path = "${path.module}/states/local.tfstate"
+  }
+
+  defaults = {
+    owner = "platform"
+  }
+}
+
+data "terraform_remote_state" "missing" {
+  backend = "gcs"
+
+  config = {
+    bucket = "example-terraform-state"
+    prefix = "missing"
+  }
+}
+
+resource "aws_security_group" "app" {
+  name   = "app"
+  vpc_id = data.terraform_remote_state.network.outputs.vpc_id
+}
+
+resource "aws_instance" "app" {
+  subnet_id = data.terraform_remote_state.network.outputs.subnet_ids[0]
+
+  tags = {
+    App         = data.terraform_remote_state.app.outputs.app_name
+    Environment = data.terraform_remote_state.prefixed.outputs.environment
+    Owner       = data.terraform_remote_state.local.outputs.owner
+    Team        = data.terraform_remote_state.local.outputs.team
+  }
+}
+
+resource "aws_instance" "missing" {
+  subnet_id = data.terraform_remote_state.missing.outputs.subnet_id
+}
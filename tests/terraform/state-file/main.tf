@@ -0,0 +1,42 @@
+data "aws_caller_identity" "current" {}
+
+data "http" "example" {
+  url = "https://checkpoint-api.hashicorp.com/v1/check/terraform"
+}
+
+locals {
+  account_id = data.aws_caller_identity.current.account_id
+  boundary   = "arn:aws:iam::${local.account_id}:policy/BoundaryPolicy"
+}
+
+resource "aws_s3_bucket" "logs" {
+  bucket = "access-logs"
+}
+
+resource "aws_iam_role" "direct_reference" {
+  permissions_boundary = data.aws_caller_identity.current.account_id
+}
+
+resource "aws_iam_role" "local_reference" {
+  permissions_boundary = local.boundary
+}
+
+resource "aws_db_parameter_group" "tagged" {
+  name   = "tagged"
+  family = "postgres16"
+
+  tags = merge(
+    { Environment = "sandbox" },
+    { ApplyTimeVal = data.http.example.status_code },
+  )
+}
+
+resource "aws_s3_bucket_logging" "example" {
+  bucket        = "example"
+  target_bucket = aws_s3_bucket.logs.arn
+  target_prefix = "log/"
+}
+
+resource "aws_iam_role" "not_in_state" {
+  permissions_boundary = data.aws_iam_policy.missing.arn
+}
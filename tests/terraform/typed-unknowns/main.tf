@@ -0,0 +1,26 @@
+variable "subnet_ids" {
+  type = list(string)
+}
+
+variable "tags" {
+  type = map(string)
+  default = {
+    Team = "platform"
+  }
+}
+
+data "aws_caller_identity" "current" {}
+
+resource "aws_s3_bucket" "logs" {
+  bucket = "logs-${data.aws_caller_identity.current.account_id}"
+  tags = merge(var.tags, {
+    Owner = data.aws_caller_identity.current.account_id
+  })
+}
+
+resource "aws_instance" "web" {
+  count                  = length(var.subnet_ids)
+  subnet_id              = var.subnet_ids[0]
+  vpc_security_group_ids = var.subnet_ids
+  user_data              = jsonencode({ bucket = aws_s3_bucket.logs.bucket })
+}
@@ -0,0 +1,21 @@
+variable "env" {
+  type = string
+}
+
+variable "subnets" {
+  type = list(object({ id = string }))
+}
+
+locals {
+  sizes = {
+    prod = "m5.large"
+    dev  = "t3.micro"
+  }
+}
+
+resource "aws_instance" "web" {
+  ami           = "ami-${var.env == "prod" ? "0abc" : "0def"}"
+  instance_type = "size-${local.sizes[var.env]}"
+  subnet_id     = "subnet-${join(",", [for s in var.subnets : s.id])}"
+  user_data     = "env=${var.env} size=${local.sizes["prod"]}"
+}
@@ -0,0 +1,40 @@
+variable "name" {
+  type = string
+}
+
+variable "instance_count" {
+  type    = number
+  default = 1
+}
+
+variable "zones" {
+  type    = list(string)
+  default = []
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+variable "settings" {
+  type = object({
+    enabled   = bool
+    retention = number
+  })
+}
+
+variable "untyped" {}
+
+resource "aws_s3_bucket" "example" {
+  count  = var.instance_count
+  bucket = "${var.name}-${count.index}"
+  tags = merge(var.tags, {
+    Zones   = join(",", var.zones)
+    Untyped = var.untyped
+  })
+}
+
+output "settings" {
+  value = var.settings
+}
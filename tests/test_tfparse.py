@@ -1,3 +1,4 @@
+import json
 import os.path
 import platform
 import shutil
@@ -9,7 +10,7 @@ from unittest.mock import ANY
 import pytest
 from pytest_terraform.tf import TerraformRunner
 
-from tfparse import ParseError, load_from_path
+from tfparse import ParseError, load_from_path, stream_from_path
 
 
 def init_module(module_name, tmp_path, run_init=True):
@@ -45,6 +46,66 @@ def test_parse_no_dir(tmp_path):
         assert "no such file or directory" in str(e_info)
 
 
+def test_parse_timeout(tmp_path):
+    mod_path = init_module("references", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path, timeout=60)
+    assert len(parsed["aws_s3_bucket"]) == 4
+
+    with pytest.raises(ValueError):
+        load_from_path(mod_path, timeout=0)
+    with pytest.raises(ValueError):
+        load_from_path(mod_path, timeout=2**31)
+
+
+def test_stream_from_path(tmp_path):
+    mod_path = init_module("references", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    streamed = {}
+    stream_from_path(
+        mod_path, lambda key, block: streamed.setdefault(key, []).append(block)
+    )
+    assert streamed.keys() == parsed.keys()
+    assert len(streamed["aws_s3_bucket"]) == len(parsed["aws_s3_bucket"])
+
+    seen = []
+    stream_from_path(mod_path, lambda key, block: seen.append(key) or True)
+    assert len(seen) == 1
+
+    def fail(key, block):
+        raise KeyError(key)
+
+    with pytest.raises(KeyError):
+        stream_from_path(mod_path, fail)
+
+
+def test_parse_diagnostics(tmp_path):
+    mod_path = init_module("diagnostics", tmp_path, run_init=False)
+
+    parsed = load_from_path(mod_path)
+    assert "__diagnostics__" not in parsed
+
+    parsed = load_from_path(mod_path, diagnostics=True)
+    assert [item["__tfmeta"]["path"] for item in parsed["aws_s3_bucket"]] == [
+        "aws_s3_bucket.example"
+    ]
+    syntax_error, missing_vars, missing_module = parsed["__diagnostics__"]
+    assert syntax_error == {
+        "severity": "error",
+        "summary": "Invalid expression",
+        "detail": ANY,
+        "filename": "broken.tf",
+        "range": {"line_start": 2, "column_start": 11, "line_end": 3, "column_end": 1},
+    }
+    assert missing_vars["severity"] == "warning"
+    assert missing_vars["detail"] == "variables: environment"
+    assert missing_module["severity"] == "error"
+    assert missing_module["path"] == "module.missing"
+
+    streamed = stream_from_path(mod_path, lambda key, block: None, diagnostics=True)
+    assert streamed["__diagnostics__"] == parsed["__diagnostics__"]
+
+
 def test_vars(tmp_path):
     mod_path = init_module("vars-file", tmp_path, run_init=False)
     parsed = load_from_path(mod_path, vars_paths=["example.tfvars"])
@@ -52,6 +113,207 @@ def test_vars(tmp_path):
     assert item["content"] == "goodbye"
 
 
+def test_data_source_stubs(tmp_path):
+    mod_path = init_module("data-source-stubs", tmp_path, run_init=False)
+
+    for stubs in ("stubs.yaml", "stubs.json"):
+        parsed = load_from_path(mod_path, data_source_stubs=stubs)
+
+        (role,) = parsed["aws_iam_role"]
+        assert role["permissions_boundary"] == (
+            "arn:aws:iam::123456789012:policy/boundary"
+        )
+        assert role["tags"] == {
+            "Region": "us-east-1",
+            "Role": "arn:aws:iam::123456789012:role/deploy",
+        }
+        assert role["__tfmeta"]["value_sources"] == {
+            "permissions_boundary": "stub",
+            "tags": "stub",
+        }
+
+        (bucket,) = parsed["google_storage_bucket"]
+        assert bucket["name"] == "example-project-logs"
+
+        # the stubbed data sources show their stubs too
+        (region,) = parsed["aws_region"]
+        assert region["name"] == "us-east-1"
+        assert region["__tfmeta"]["value_sources"] == {"name": "stub"}
+
+        # data sources in child modules are stubbed too
+        (instance,) = parsed["aws_instance"]
+        assert instance["tags"] == {"Owner": "123456789012"}
+
+    with pytest.raises(ParseError):
+        load_from_path(mod_path, data_source_stubs="missing.yaml")
+
+
+def test_iam_policy_document(tmp_path):
+    mod_path = init_module("iam-policy-document", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path, policy_documents=True)
+
+    (policy,) = parsed["aws_iam_policy"]
+    assert policy["__tfmeta"]["value_sources"] == {"policy": "emulated"}
+    document = json.loads(policy["policy"])
+    assert document["Version"] == "2012-10-17"
+    # the override replaces the source statement with the same Sid
+    assert [s.get("Sid") for s in document["Statement"]] == [
+        "ReadBucket",
+        "HomeDirectory",
+        None,
+    ]
+    assert document["Statement"][0]["Effect"] == "Deny"
+    assert document["Statement"][2]["Condition"] == {
+        "Bool": {"aws:SecureTransport": "false"}
+    }
+
+    (role,) = parsed["aws_iam_role"]
+    (statement,) = json.loads(role["assume_role_policy"])["Statement"]
+    assert statement["Principal"] == {
+        "AWS": ["arn:aws:iam::210987654321:root", "arn:aws:iam::123456789012:root"],
+        "Service": "lambda.amazonaws.com",
+    }
+
+    (bucket_policy,) = parsed["aws_s3_bucket_policy"]
+    statements = json.loads(bucket_policy["policy"])["Statement"]
+    assert [s["Principal"] for s in statements] == ["*", "*"]
+
+    documents = {
+        d["__tfmeta"]["path"]: d for d in parsed["aws_iam_policy_document"]
+    }
+    base = json.loads(documents["data.aws_iam_policy_document.base"]["json"])
+    assert base["Statement"][1]["Resource"] == (
+        "arn:aws:s3:::example-bucket/home/${aws:username}/*"
+    )
+
+
+def test_file_data_sources(tmp_path):
+    mod_path = init_module("file-data-sources", tmp_path, run_init=False)
+
+    parsed = load_from_path(mod_path)
+    dir_function, file_function = parsed["aws_lambda_function"]
+    assert "value_sources" not in dir_function["__tfmeta"]
+
+    parsed = load_from_path(mod_path, file_data_sources=True)
+    archives = {a["__tfmeta"]["path"]: a for a in parsed["archive_file"]}
+    dir_function, file_function = parsed["aws_lambda_function"]
+    assert dir_function["source_code_hash"] == (
+        archives["data.archive_file.dir"]["output_base64sha256"]
+    )
+    assert dir_function["__tfmeta"]["value_sources"] == {
+        "source_code_hash": "emulated"
+    }
+    assert file_function["source_code_hash"] == (
+        archives["data.archive_file.file"]["output_base64sha256"]
+    )
+
+    (secret,) = parsed["aws_ssm_parameter"]
+    assert secret["value"] == "(sensitive value)"
+
+    (config,) = parsed["aws_s3_object"]
+    assert config["content"] == '{"environment": "sandbox"}\n'
+    assert config["etag"] == "61d693dd7b9e4bd02e44e79124733d02"
+    assert config["tags"] == {"Environment": "sandbox"}
+
+
+def test_remote_state(tmp_path):
+    mod_path = init_module("remote-state", tmp_path, run_init=False)
+    parsed = load_from_path(
+        mod_path,
+        remote_state_files={"s3:network/terraform.tfstate": "states/network.tfstate"},
+        remote_state_dir="states",
+    )
+
+    (group,) = parsed["aws_security_group"]
+    assert group["vpc_id"] == "vpc-0123456789abcdef0"
+
+    app, missing = parsed["aws_instance"]
+    assert app["subnet_id"] == "subnet-0a"
+    assert app["tags"] == {
+        "App": "custodian",
+        "Environment": "production",
+        "Owner": "platform",
+        "Team": "cloud",
+    }
+    assert app["__tfmeta"]["value_sources"] == {
+        "subnet_id": "emulated",
+        "tags": "emulated",
+    }
+    # remote states without a local state file are left alone
+    assert missing["subnet_id"]["__attribute__"] == (
+        "data.terraform_remote_state.missing.outputs.subnet_id"
+    )
+
+
+def test_state_file(tmp_path):
+    mod_path = init_module("state-file", tmp_path, run_init=False)
+
+    parsed = load_from_path(mod_path)
+    direct, local, missing = parsed["aws_iam_role"]
+    assert direct["permissions_boundary"]["__attribute__"] == (
+        "data.aws_caller_identity.current.account_id"
+    )
+
+    parsed = load_from_path(mod_path, state_file="terraform.tfstate")
+    direct, local, missing = parsed["aws_iam_role"]
+    assert direct["permissions_boundary"] == "123456789012"
+    assert direct["__tfmeta"]["value_sources"] == {"permissions_boundary": "state"}
+    assert local["permissions_boundary"] == (
+        "arn:aws:iam::123456789012:policy/BoundaryPolicy"
+    )
+    # values missing from state are left alone
+    assert "value_sources" not in missing["__tfmeta"]
+
+    (group,) = parsed["aws_db_parameter_group"]
+    assert group["tags"] == {"ApplyTimeVal": 200, "Environment": "sandbox"}
+
+    with pytest.raises(ParseError):
+        load_from_path(mod_path, state_file="missing.tfstate")
+
+
+def test_plan_file(tmp_path):
+    mod_path = init_module("plan-file", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path, plan_file="plan.json")
+
+    (role,) = parsed["aws_iam_role"]
+    assert role["permissions_boundary"] == (
+        "arn:aws:iam::123456789012:policy/boundary-123456789012"
+    )
+    assert role["__tfmeta"]["value_sources"] == {"permissions_boundary": "plan"}
+    assert role["__tfmeta"]["after_unknown"] == ["arn", "id"]
+
+    # data sources are read in to the prior state
+    (policy,) = parsed["aws_iam_policy"]
+    assert policy["name"] == "boundary-123456789012"
+    assert policy["__tfmeta"]["value_sources"] == {"name": "prior_state"}
+
+    # resources in modules are matched by their full address
+    (bucket,) = parsed["aws_s3_bucket"]
+    assert bucket["bucket"] == "123456789012-logs"
+
+    # attributes that are unknown until apply are flagged, not filled in
+    instance = parsed["aws_instance"][0]
+    assert "subnet_id" in instance["__tfmeta"]["after_unknown"]
+    assert "value_sources" not in instance["__tfmeta"]
+
+    # values that are known from configuration are kept
+    groups = {
+        group["__tfmeta"]["path"]: group for group in parsed["aws_security_group"]
+    }
+    group = groups["aws_security_group.web"]
+    assert group["vpc_id"] == "vpc-12345678"
+    assert group["tags"]["Name"] == "web"
+    assert group["tags"]["Account"] == "123456789012"
+    assert group["__tfmeta"]["value_sources"] == {"tags": "plan"}
+    assert group["__tfmeta"]["after_unknown"] == ["arn", "tags.Subnet"]
+
+    # nested blocks are matched to the plan's by their known values
+    postgres, ssh = groups["aws_security_group.db"]["ingress"]
+    assert postgres["description"] == "postgres from 123456789012"
+    assert postgres["__tfmeta"]["value_sources"] == {"description": "plan"}
+    assert "value_sources" not in ssh["__tfmeta"]
+
+
 def test_multiple_var_files(tmp_path):
     (tmp_path / "main.tf").write_text(
         """
@@ -76,6 +338,106 @@ def test_multiple_var_files(tmp_path):
     assert item["name"] == "my-app-logs"
 
 
+def test_variable_values(tmp_path):
+    mod_path = init_module("variable-values", tmp_path, run_init=False)
+    parsed = load_from_path(
+        mod_path,
+        vars_paths=["values.tfvars"],
+        variables={
+            "instance_count": "2",
+            "tags": '{Team = "platform"}',
+            "untyped": "[1, 2]",
+        },
+        env_variables={
+            "TF_VAR_name": "from-env",
+            "TF_VAR_zones": '["us-east-1a", "us-east-1b"]',
+            "TF_VAR_settings": "{enabled = true, retention = 30}",
+        },
+    )
+
+    buckets = parsed["aws_s3_bucket"]
+    # the tfvars file takes precedence over the environment
+    assert [bucket["bucket"] for bucket in buckets] == ["from-file-0", "from-file-1"]
+    assert buckets[0]["tags"] == {
+        "Team": "platform",
+        # an untyped variable is taken literally
+        "Untyped": "[1, 2]",
+        "Zones": "us-east-1a,us-east-1b",
+    }
+    assert get_outputs(parsed) == {"settings": {"enabled": True, "retention": 30}}
+
+    sources = {
+        var["__tfmeta"]["label"]: var["__tfmeta"]["value_source"]
+        for var in parsed["variable"]
+    }
+    assert sources == {
+        "instance_count": "var",
+        "name": "values.tfvars",
+        "settings": "env",
+        "tags": "var",
+        "untyped": "var",
+        "zones": "env",
+    }
+
+    # like terraform plan, a value for an undeclared variable is an error
+    with pytest.raises(ParseError):
+        load_from_path(mod_path, variables={"undeclared": "value"})
+
+
+def test_empty_env_variables(tmp_path, monkeypatch):
+    monkeypatch.setenv("TF_VAR_name", "from-process")
+    (tmp_path / "main.tf").write_text(
+        """
+        variable "name" {
+          default = "from-default"
+        }
+
+        resource "aws_s3_bucket" "example" {
+          bucket = var.name
+        }
+        """
+    )
+
+    # an empty environment replaces the process environment
+    parsed = load_from_path(tmp_path, env_variables={})
+    (bucket,) = parsed["aws_s3_bucket"]
+    assert bucket["bucket"] == "from-default"
+    (variable,) = parsed["variable"]
+    assert variable["__tfmeta"]["value"] == "from-default"
+    assert variable["__tfmeta"]["value_source"] == "default"
+
+
+def test_auto_tfvars(tmp_path):
+    mod_path = init_module("auto-tfvars", tmp_path, run_init=False)
+
+    parsed = load_from_path(
+        mod_path, vars_paths=["explicit.tfvars"], variable_files=True
+    )
+    assert parsed["__variable_files__"] == [
+        "terraform.tfvars",
+        "terraform.tfvars.json",
+        "a.auto.tfvars",
+        "b.auto.tfvars.json",
+        "explicit.tfvars",
+    ]
+    assert get_outputs(parsed)["values"] == {
+        "a": "terraform.tfvars",
+        "b": "terraform.tfvars.json",
+        "c": "a.auto.tfvars",
+        "d": "b.auto.tfvars.json",
+        "e": "explicit.tfvars",
+    }
+
+    parsed = load_from_path(mod_path, auto_load_tfvars=False, variable_files=True)
+    assert parsed["__variable_files__"] == []
+
+    streamed = stream_from_path(
+        mod_path, lambda key, block: None, auto_load_tfvars=False, variable_files=True
+    )
+    assert streamed == {"__variable_files__": []}
+    assert set(get_outputs(parsed)["values"].values()) == {"default"}
+
+
 def test_vars_bad_types(tmp_path):
     # NOTE that the "quoted_type" test case is to allow rudimentary support for TF
     # versions older than 0.12, which are still sometimes seen in the wild. It's
@@ -271,6 +633,69 @@ def test_moved_blocks(tmp_path):
     assert len(item["to"]) == 2
 
 
+def test_block_types(tmp_path):
+    mod_path = init_module("block-types", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    (instance,) = parsed["aws_instance"]
+
+    (item,) = parsed["import"]
+    assert item["id"] == ANY
+    assert item["__tfmeta"]["path"] == "import.aws_instance.web"
+    assert item["__tfmeta"]["references"] == [
+        {"id": instance["id"], "label": "aws_instance", "name": "web"}
+    ]
+    assert item["to"] == "aws_instance.web"
+
+    (item,) = parsed["removed"]
+    assert item["__tfmeta"]["path"] == "removed.aws_instance.legacy"
+    assert item["from"] == "aws_instance.legacy"
+    assert item["lifecycle"]["destroy"] is False
+
+    (item,) = parsed["check"]
+    assert item["__tfmeta"] == {
+        "filename": "main.tf",
+        "label": "health_check",
+        "line_end": 28,
+        "line_start": 19,
+        "path": "check.health_check",
+    }
+    assert item["data"]["url"] == "https://example.com"
+    assert item["data"]["__tfmeta"]["label"] == "http"
+    assert item["data"]["__tfmeta"]["path"] == "check.health_check.data.http.site"
+    assert item["assert"]["error_message"] == "site returned an unhealthy status code"
+    assert item["assert"]["condition"] == {
+        "__unresolved__": "data.http.site.status_code == 200"
+    }
+    assert item["assert"]["__tfmeta"]["path"] == "check.health_check.assert[0]"
+    assert item["assert"]["__tfmeta"]["references"] == [
+        {"id": item["data"]["id"], "label": "http", "name": "site"}
+    ]
+
+    (secret,) = parsed["aws_secretsmanager_secret_version"]
+    assert secret["__tfmeta"] == {
+        "filename": "main.tf",
+        "label": "aws_secretsmanager_secret_version",
+        "line_end": 32,
+        "line_start": 30,
+        "path": "ephemeral.aws_secretsmanager_secret_version.db_password",
+        "referenced_by": [
+            {"attribute": "value", "id": ANY, "label": "db_password", "name": ""}
+        ],
+        "type": "ephemeral",
+    }
+
+    outputs = {output["__tfmeta"]["label"]: output for output in parsed["output"]}
+    assert outputs["db_password"]["value"]["__name__"] == "db_password"
+    assert outputs["db_password"]["__tfmeta"]["references"] == [
+        {
+            "id": secret["id"],
+            "label": "aws_secretsmanager_secret_version",
+            "name": "db_password",
+        }
+    ]
+
+
 def test_parse_dynamic_content(tmp_path):
     here = os.path.dirname(__file__)
     mod_path = os.path.join(here, "terraform", "dynamic-stuff")
@@ -288,6 +713,8 @@ def test_parse_dynamic_content(tmp_path):
                 "line_end": 53,
                 "line_start": 51,
                 "path": "variable.unknown",
+                "value": None,
+                "value_source": "unset",
             },
             "id": ANY,
             "type": "set of string",
@@ -422,6 +849,8 @@ def test_parse_variables(tmp_path):
                     "line_end": 21,
                     "line_start": 19,
                     "path": "variable.has_default",
+                    "value": "the default",
+                    "value_source": "default",
                 },
                 "default": "the default",
                 "id": ANY,
@@ -433,6 +862,8 @@ def test_parse_variables(tmp_path):
                     "line_end": 29,
                     "line_start": 27,
                     "path": "variable.local_ref",
+                    "value": True,
+                    "value_source": "default",
                 },
                 "default": True,
                 "id": ANY,
@@ -444,6 +875,8 @@ def test_parse_variables(tmp_path):
                     "line_end": 25,
                     "line_start": 23,
                     "path": "variable.no_default",
+                    "value": None,
+                    "value_source": "unset",
                 },
                 "id": ANY,
                 "type": "string",
@@ -490,6 +923,50 @@ def test_references(tmp_path):
     ]
 
 
+def test_referenced_by(tmp_path):
+    mod_path = init_module("references", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    aes_bucket, kms_bucket, log_bucket, sample_bucket = parsed["aws_s3_bucket"]
+    [bucket_logging] = parsed["aws_s3_bucket_logging"]
+    assert log_bucket["__tfmeta"]["referenced_by"] == [
+        {
+            "id": bucket_logging["id"],
+            "label": "aws_s3_bucket_logging",
+            "name": "example",
+            "attribute": "target_bucket",
+        },
+    ]
+    assert sample_bucket["__tfmeta"]["referenced_by"] == [
+        {
+            "id": bucket_logging["id"],
+            "label": "aws_s3_bucket_logging",
+            "name": "example",
+            "attribute": "bucket",
+        },
+    ]
+    # the logging configuration isn't referenced by anything
+    assert "referenced_by" not in bucket_logging["__tfmeta"]
+
+
+def test_attribute_references(tmp_path):
+    mod_path = init_module("attribute-references", tmp_path, run_init=False)
+
+    parsed = load_from_path(mod_path)
+    assert "attribute_references" not in parsed["aws_instance"][0]["__tfmeta"]
+
+    parsed = load_from_path(mod_path, attribute_references=True)
+    lb, web = parsed["aws_security_group"]
+    (instance,) = parsed["aws_instance"]
+    assert web["__tfmeta"]["attribute_references"] == {
+        "ingress[0].security_groups": [lb["id"]],
+    }
+    assert instance["__tfmeta"]["attribute_references"] == {
+        "tags": [lb["id"]],
+        "vpc_security_group_ids": [web["id"]],
+    }
+
+
 def test_module_references(tmp_path):
     mod_path = init_module("module-references", tmp_path)
     parsed = load_from_path(mod_path)
@@ -508,6 +985,41 @@ def test_module_references(tmp_path):
         )
 
 
+def test_module_cross_references(tmp_path):
+    mod_path = init_module("module-cross-references", tmp_path)
+    parsed = load_from_path(mod_path)
+
+    log_bucket, module_bucket = parsed["aws_s3_bucket"]
+    bucket_ref = {
+        "id": module_bucket["id"],
+        "label": "aws_s3_bucket",
+        "name": "this",
+        "module": "module.bucket",
+    }
+
+    # module outputs are followed to the bucket inside of the module
+    (policy,) = parsed["aws_s3_bucket_policy"]
+    assert policy["__tfmeta"]["references"] == [bucket_ref]
+
+    # module inputs are followed to the bucket outside of the module
+    (logging,) = parsed["aws_s3_bucket_logging"]
+    refs = logging["__tfmeta"]["references"]
+    assert bucket_ref in refs
+    assert {
+        "id": log_bucket["id"],
+        "label": "aws_s3_bucket",
+        "name": "logs",
+    } in refs
+
+    # as are the reverse references
+    assert {
+        "id": policy["id"],
+        "label": "aws_s3_bucket_policy",
+        "name": "outside_module",
+        "attribute": "bucket",
+    } in module_bucket["__tfmeta"]["referenced_by"]
+
+
 def test_modules_located_above_root(tmp_path):
     mod_path = init_module("local-module-above-root", tmp_path)
     parsed = load_from_path(os.path.join(mod_path, "root"))
@@ -546,6 +1058,158 @@ def test_module_input_output(tmp_path):
     # check the bucket has the tags
     assert parsed["aws_s3_bucket"][0]["tags"] == asserted_tags
 
+    # check the module variable reports its input from the module block
+    variables = {var["__tfmeta"]["path"]: var["__tfmeta"] for var in parsed["variable"]}
+    meta = variables["module.bucket.variable.default_tags"]
+    assert meta["value"] == asserted_tags
+    assert meta["value_source"] == "module.bucket"
+
+
+def test_module_scoped_lookups(tmp_path):
+    mod_path = init_module("module-scoped-lookups", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    # both modules declare a "tags" variable and an "extra" local value, each
+    # bucket must use those of its own module
+    buckets = {bucket["bucket"]: bucket for bucket in parsed["aws_s3_bucket"]}
+    owner = {"__unresolved__": "data.aws_caller_identity.current.account_id"}
+    assert buckets["first"]["tags"] == {"Owner": owner, "Team": "first"}
+    assert buckets["first"]["tags_all"] == {"Module": "first", "Owner": owner}
+    assert buckets["second"]["tags"] == {"Owner": owner, "Team": "second"}
+    assert buckets["second"]["tags_all"] == {"Module": "second", "Owner": owner}
+
+
+def test_partial_functions(tmp_path):
+    mod_path = init_module("partial-functions", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    # unknown arguments are kept as markers with their source, while the known
+    # parts of the result are kept as they are
+    (bucket,) = parsed["aws_s3_bucket"]
+    assert (
+        bucket["bucket"]
+        == "logs-${data.aws_caller_identity.current.account_id}-archive"
+    )
+    assert bucket["tags"] == {
+        "Owner": {"__unresolved__": "data.aws_caller_identity.current.account_id"},
+        "Region": "current-region-primary",
+        "Team": "platform",
+    }
+
+    (instance,) = parsed["aws_instance"]
+    assert instance["ami"] == {"__unresolved__": "var.ami"}
+    assert instance["vpc_security_group_ids"] == [
+        "sg-12345678",
+        {"__unresolved__": "var.subnet_ids"},
+        "SG-ABCDEF",
+    ]
+    # functions that would need to look in to an unknown value are unknown
+    assert instance["tags"] == {
+        "Environment": "production",
+        "Image": {"__unresolved__": 'lookup(var.amis, "prod", "ami-default")'},
+        "Mode": {
+            "__unresolved__": 'length(var.subnet_ids) > 1 ? "MULTI" : "SINGLE"'
+        },
+        "Team": "platform",
+    }
+
+    (policy,) = parsed["aws_iam_policy"]
+    statement = json.loads(policy["policy"])["Statement"][0]
+    assert statement["Principal"] == {"AWS": {"__unresolved__": "var.principal_arn"}}
+    assert statement["Resource"] == "arn:aws:s3:::${aws_s3_bucket.merged.bucket}/*"
+
+
+def test_typed_unknowns(tmp_path):
+    mod_path = init_module("typed-unknowns", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path, typed_unknowns=True)
+
+    account_id = "data.aws_caller_identity.current.account_id"
+    (bucket,) = parsed["aws_s3_bucket"]
+    assert bucket["bucket"] == {
+        "__unknown__": True,
+        "type": "string",
+        "source": '"logs-${data.aws_caller_identity.current.account_id}"',
+        "formatted": '"logs-${data.aws_caller_identity.current.account_id}"',
+        "references": [account_id],
+        "refinements": {"not_null": True, "prefix": "logs-"},
+    }
+    assert bucket["tags"] == {
+        "Owner": {
+            "__unknown__": True,
+            "type": "any",
+            "source": account_id,
+            "formatted": account_id,
+            "references": [account_id],
+        },
+        "Team": "platform",
+    }
+
+    (instance,) = parsed["aws_instance"]
+    assert instance["vpc_security_group_ids"] == {
+        "__unknown__": True,
+        "type": "list(string)",
+        "source": "var.subnet_ids",
+        "formatted": "var.subnet_ids",
+        "references": ["var.subnet_ids"],
+    }
+    assert instance["count"]["type"] == "number"
+    assert instance["user_data"]["refinements"] == {
+        "not_null": True,
+        "prefix": '{"bucket":"',
+    }
+
+    variables = {v["__tfmeta"]["label"]: v["__tfmeta"] for v in parsed["variable"]}
+    assert variables["subnet_ids"]["value"] == {
+        "__unknown__": True,
+        "type": "list(string)",
+        "source": "var.subnet_ids",
+        "formatted": "var.subnet_ids",
+    }
+
+
+def test_unresolved_source(tmp_path):
+    mod_path = init_module("unresolved-source", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path)
+
+    (instance,) = parsed["aws_instance"]
+    assert instance["ami"] == 'ami-${var.env == "prod" ? "0abc" : "0def"}'
+    assert instance["instance_type"] == "size-${local.sizes[var.env]}"
+    assert instance["subnet_id"] == 'subnet-${join(",", [for s in var.subnets : s.id])}'
+    assert instance["user_data"] == 'env=${var.env} size=${local.sizes["prod"]}'
+
+
+def test_conditional_branches(tmp_path):
+    mod_path = init_module("conditional-branches", tmp_path, run_init=False)
+    parsed = load_from_path(mod_path, conditional_branches=True)
+
+    (config,) = parsed["aws_s3_bucket_server_side_encryption_configuration"]
+    default = config["rule"]["apply_server_side_encryption_by_default"]
+    assert default["sse_algorithm"] == {
+        "__one_of__": ["aws:kms", "AES256"],
+        "condition": "var.encrypted",
+    }
+    assert default["kms_master_key_id"]["__one_of__"][1] is None
+
+    (instance,) = parsed["aws_instance"]
+    assert instance["instance_type"] == {
+        "__one_of__": [
+            "m5.large",
+            {
+                "__one_of__": ["t3.large", "t3.micro"],
+                "condition": 'var.env == "staging"',
+            },
+        ],
+        "condition": 'var.env == "prod"',
+    }
+    assert instance["monitoring"] is None
+    # a condition that can't be evaluated doesn't list the branches
+    assert instance["ebs_optimized"] is None
+
+    parsed = load_from_path(mod_path)
+    (config,) = parsed["aws_s3_bucket_server_side_encryption_configuration"]
+    default = config["rule"]["apply_server_side_encryption_by_default"]
+    assert default["sse_algorithm"] is None
+
 
 def test_module_input_output_nested(tmp_path):
     root_path = init_module("module-in-out-nested", tmp_path)
@@ -631,14 +1295,18 @@ def test_ec2_tags(tmp_path):
     }
 
     # Test tagged_unknown_values instance
+    # var.additional_tags has no value, so its keys are marked as unresolved
     unknown_tags = parsed["aws_instance"][1]["tags"]
     assert unknown_tags == {
         "Var1": "current-region-test",
         "Var2": "test",
         "Var3": "current-region",
-        "Unknown": None,
+        "Unknown": {
+            "__unresolved__": "data.terraform_remote_state.example.outputs.app_name"
+        },
         "Environment": "sandbox",
         "Name": "tagged unknown",
+        "__unresolved__": "var.additional_tags",
     }
 
     # Test untagged instance
@@ -654,12 +1322,16 @@ def test_apply_time_vals(tmp_path):
     parsed = load_from_path(mod_path)
 
     # Test resource with local.default_tags merged with apply-time values
+    apply_time_val = {"__unresolved__": "data.http.example.status_code"}
     with_local_tags = parsed["aws_db_parameter_group"][1]["tags"]
-    assert with_local_tags == {"Environment": "sandbox", "ApplyTimeVal": None}
+    assert with_local_tags == {
+        "Environment": "sandbox",
+        "ApplyTimeVal": apply_time_val,
+    }
 
     # Test resource with var.tags merged with apply-time values
     with_var_tags = parsed["aws_db_parameter_group"][2]["tags"]
-    assert with_var_tags == {"Environment": "sandbox", "ApplyTimeVal": None}
+    assert with_var_tags == {"Environment": "sandbox", "ApplyTimeVal": apply_time_val}
 
     # Test untagged resource
     untagged = parsed["aws_db_parameter_group"][0]
@@ -701,9 +1373,14 @@ def test_wholly_known_foreach(tmp_path):
 def test_not_wholly_known_foreach(tmp_path):
     mod_path = init_module("not-wholly-known-for_each", tmp_path, run_init=False)
     parsed = load_from_path(mod_path)
-    assert parsed["locals"][0]["current_month"] is None
+    assert parsed["locals"][0]["current_month"] == {
+        "__unresolved__": 'formatdate("M", plantimestamp())'
+    }
     assert parsed["locals"][0]["last_month"] is None
-    assert parsed["terraform_data"][0]["for_each"] is None
+    assert parsed["terraform_data"][0]["for_each"] == [
+        {"__unresolved__": "local.last_month"},
+        {"__unresolved__": "local.current_month"},
+    ]
 
 
 def test_module_output_json_string(tmp_path):
@@ -23,6 +23,108 @@ class ParseError(Exception):
     pass
 
 
+# timeouts are passed to the go side in milliseconds as a 32 bit int
+_MAX_TIMEOUT_MS = 2**31 - 1
+
+
+def _parse_args(
+    filePath,
+    stop_on_hcl_error,
+    debug,
+    allow_downloads,
+    workspace_name,
+    vars_paths,
+    variables,
+    env_variables,
+    auto_load_tfvars,
+    attribute_references,
+    typed_unknowns,
+    conditional_branches,
+    policy_documents,
+    file_data_sources,
+    remote_state_files,
+    remote_state_dir,
+    data_source_stubs,
+    state_file,
+    plan_file,
+    timeout,
+):
+    if not isinstance(filePath, (str, Path)):
+        raise ValueError("filePath must be str or Path, got %s" % type(filePath))
+    if timeout is not None and timeout <= 0:
+        raise ValueError(
+            "timeout must be a positive number of seconds, got %s" % timeout
+        )
+
+    # the go side takes a timeout in milliseconds, where 0 means no timeout
+    timeout_ms = max(1, int(timeout * 1000)) if timeout is not None else 0
+    if timeout_ms > _MAX_TIMEOUT_MS:
+        raise ValueError(
+            "timeout must be at most %s seconds, got %s"
+            % (_MAX_TIMEOUT_MS // 1000, timeout)
+        )
+
+    options = {
+        "stop_on_hcl_error": bool(stop_on_hcl_error),
+        "debug": bool(debug),
+        "allow_downloads": bool(allow_downloads),
+        "workspace_name": str(workspace_name),
+        "vars_paths": [str(vars_path) for vars_path in vars_paths or []],
+        "variables": {
+            str(name): str(value) for name, value in (variables or {}).items()
+        },
+        # without an environment, the go side reads the process environment
+        "env_variables": (
+            None
+            if env_variables is None
+            else {str(key): str(value) for key, value in env_variables.items()}
+        ),
+        "auto_load_tfvars": bool(auto_load_tfvars),
+        "attribute_references": bool(attribute_references),
+        "typed_unknowns": bool(typed_unknowns),
+        "conditional_branches": bool(conditional_branches),
+        "policy_documents": bool(policy_documents),
+        "file_data_sources": bool(file_data_sources),
+        "remote_state_files": {
+            str(key): str(state_path)
+            for key, state_path in (remote_state_files or {}).items()
+        },
+        # an empty path means no remote state directory, stubs, state or plan file
+        "remote_state_dir": str(remote_state_dir or ""),
+        "data_source_stubs": str(data_source_stubs or ""),
+        "state_file": str(state_file or ""),
+        "plan_file": str(plan_file or ""),
+        "timeout_ms": timeout_ms,
+    }
+
+    return (
+        ffi.new("char[]", str(filePath).encode("utf8")),
+        ffi.new("char[]", json.dumps(options).encode("utf8")),
+    )
+
+
+def _raise_error(err):
+    msg = ffi.string(err)
+    if sys.platform != "win32":
+        ffi.gc(err, lib.free)
+    raise ParseError(msg.decode("utf8"))
+
+
+def _read_metadata(ret, diagnostics, variable_files):
+    ret_diagnostics = ffi.string(ret.diagnostics)
+    ret_variable_files = ffi.string(ret.variable_files)
+    if sys.platform != "win32":
+        ffi.gc(ret.diagnostics, lib.free)
+        ffi.gc(ret.variable_files, lib.free)
+
+    metadata = {}
+    if diagnostics:
+        metadata["__diagnostics__"] = json.loads(ret_diagnostics)
+    if variable_files:
+        metadata["__variable_files__"] = json.loads(ret_variable_files)
+    return metadata
+
+
 def load_from_path(
     filePath: str,
     stop_on_hcl_error: bool = False,
@@ -30,37 +132,141 @@ def load_from_path(
     allow_downloads: bool = False,
     workspace_name: str = "default",
     vars_paths=None,  # list[str]
+    variables: tp.Optional[tp.Dict[str, str]] = None,
+    env_variables: tp.Optional[tp.Mapping[str, str]] = None,
+    auto_load_tfvars: bool = True,
+    attribute_references: bool = False,
+    typed_unknowns: bool = False,
+    conditional_branches: bool = False,
+    policy_documents: bool = False,
+    file_data_sources: bool = False,
+    remote_state_files: tp.Optional[tp.Dict[str, str]] = None,
+    remote_state_dir: tp.Optional[str] = None,
+    data_source_stubs: tp.Optional[str] = None,
+    state_file: tp.Optional[str] = None,
+    plan_file: tp.Optional[str] = None,
+    timeout: tp.Optional[float] = None,
+    diagnostics: bool = False,
+    variable_files: bool = False,
 ) -> tp.Dict:
-    if not isinstance(filePath, (str, Path)):
-        raise ValueError("filePath must be str or Path, got %s" % type(filePath))
-
-    path = ffi.new("char[]", str(filePath).encode("utf8"))
-    workspace = ffi.new("char[]", str(workspace_name).encode("utf8"))
-
-    vars_paths = vars_paths or []
-    num_var_paths = len(vars_paths)
-    c_var_paths = [
-        ffi.new("char[]", str(vars_path).encode("utf8")) for vars_path in vars_paths
-    ]
-
     ret = lib.Parse(
-        path,
-        stop_on_hcl_error,
-        debug,
-        allow_downloads,
-        workspace,
-        num_var_paths,
-        c_var_paths,
+        *_parse_args(
+            filePath,
+            stop_on_hcl_error,
+            debug,
+            allow_downloads,
+            workspace_name,
+            vars_paths,
+            variables,
+            env_variables,
+            auto_load_tfvars,
+            attribute_references,
+            typed_unknowns,
+            conditional_branches,
+            policy_documents,
+            file_data_sources,
+            remote_state_files,
+            remote_state_dir,
+            data_source_stubs,
+            state_file,
+            plan_file,
+            timeout,
+        )
     )
 
     if ret.err != ffi.NULL:
-        err = ffi.string(ret.err)
-        if sys.platform != "win32":
-            ffi.gc(ret.err, lib.free)
-        err = err.decode("utf8")
-        raise ParseError(err)
+        _raise_error(ret.err)
 
     ret_json = ffi.string(ret.json)
     if sys.platform != "win32":
         ffi.gc(ret.json, lib.free)
-    return json.loads(ret_json)
+
+    parsed = json.loads(ret_json)
+    parsed.update(_read_metadata(ret, diagnostics, variable_files))
+    return parsed
+
+
+def stream_from_path(
+    filePath: str,
+    callback: tp.Callable[[str, tp.Dict], tp.Optional[bool]],
+    stop_on_hcl_error: bool = False,
+    debug: bool = False,
+    allow_downloads: bool = False,
+    workspace_name: str = "default",
+    vars_paths=None,  # list[str]
+    variables: tp.Optional[tp.Dict[str, str]] = None,
+    env_variables: tp.Optional[tp.Mapping[str, str]] = None,
+    auto_load_tfvars: bool = True,
+    attribute_references: bool = False,
+    typed_unknowns: bool = False,
+    conditional_branches: bool = False,
+    policy_documents: bool = False,
+    file_data_sources: bool = False,
+    remote_state_files: tp.Optional[tp.Dict[str, str]] = None,
+    remote_state_dir: tp.Optional[str] = None,
+    data_source_stubs: tp.Optional[str] = None,
+    state_file: tp.Optional[str] = None,
+    plan_file: tp.Optional[str] = None,
+    timeout: tp.Optional[float] = None,
+    diagnostics: bool = False,
+    variable_files: bool = False,
+) -> tp.Dict:
+    """Parse a module like load_from_path, but call callback with the type
+    and contents of each block as soon as it has been parsed, rather than
+    building all of the blocks in memory at once.
+
+    Returning True from the callback stops parsing early. An exception raised
+    by the callback also stops parsing, and is raised once it has stopped.
+
+    Returns the keys that load_from_path adds besides the blocks, such as
+    __diagnostics__ with diagnostics=True.
+    """
+    errors = []
+
+    @ffi.callback("int(char *, void *)")
+    def on_block(line, userdata):
+        try:
+            ((key, block),) = json.loads(ffi.string(line)).items()
+            return 1 if callback(key, block) else 0
+        except BaseException as e:
+            errors.append(e)
+            return 1
+
+    ret = lib.ParseStream(
+        *_parse_args(
+            filePath,
+            stop_on_hcl_error,
+            debug,
+            allow_downloads,
+            workspace_name,
+            vars_paths,
+            variables,
+            env_variables,
+            auto_load_tfvars,
+            attribute_references,
+            typed_unknowns,
+            conditional_branches,
+            policy_documents,
+            file_data_sources,
+            remote_state_files,
+            remote_state_dir,
+            data_source_stubs,
+            state_file,
+            plan_file,
+            timeout,
+        ),
+        on_block,
+        ffi.NULL,
+    )
+
+    if ret.err != ffi.NULL:
+        if errors:
+            if sys.platform != "win32":
+                ffi.gc(ret.err, lib.free)
+            raise errors[0]
+        _raise_error(ret.err)
+
+    metadata = _read_metadata(ret, diagnostics, variable_files)
+    if errors:
+        raise errors[0]
+    return metadata
@@ -17,9 +17,14 @@ ffi.cdef(
         typedef struct {
             char *json;
             char *err;
+            char *diagnostics;
+            char *variable_files;
         } parseResponse;
 
-        parseResponse Parse(char* a, int stop_on_error, int debug, int allow_downloads, char* workspace_name, int num_vars_files, char** vars_files);
+        typedef int (*blockCallback)(char *json, void *userdata);
+
+        parseResponse Parse(char* a, char* options);
+        parseResponse ParseStream(char* a, char* options, blockCallback callback, void *userdata);
         void free(void *ptr);
         """  # noqa
 )